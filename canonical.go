@@ -0,0 +1,84 @@
+package goleptjson
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"unicode/utf16"
+)
+
+// LeptCanonicalize 按照 RFC 8785 (JSON Canonicalization Scheme) 输出 v 的规范化表示，
+// 相同的数据总是得到相同的字节，可以用于签名。
+// object 的成员按照 key 的 UTF-16 编码单元排序，数字使用 ECMAScript 的格式，
+// 字符串只转义必须转义的字符；重复的 key，非法的 UTF-8 以及 NaN Infinity 返回错误
+func LeptCanonicalize(v *LeptValue) ([]byte, error) {
+	var buf bytes.Buffer
+	o := &options{utf8: UTF8Reject, canonical: true}
+	if err := leptWriteCanonical(&buf, v, o); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// leptWriteCanonical 和 leptWriteValue 相同，只是 object 的成员需要排序
+func leptWriteCanonical(buf *bytes.Buffer, v *LeptValue, o *options) error {
+	switch v.typ {
+	case LeptArray:
+		buf.WriteByte('[')
+		for i, vi := range v.a {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := leptWriteCanonical(buf, vi, o); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case LeptObject:
+		members := make([]canonicalMember, len(v.o))
+		for i, m := range v.o {
+			members[i] = canonicalMember{key: utf16.Encode([]rune(m.key)), m: m}
+		}
+		sort.Slice(members, func(i, j int) bool {
+			return compareUTF16(members[i].key, members[j].key) < 0
+		})
+		buf.WriteByte('{')
+		for i, cm := range members {
+			if i > 0 {
+				if compareUTF16(members[i-1].key, cm.key) == 0 {
+					return fmt.Errorf("LeptCanonicalize duplicate key: %q", cm.m.key)
+				}
+				buf.WriteByte(',')
+			}
+			if err := leptWriteString(buf, cm.m.key, o); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := leptWriteCanonical(buf, cm.m.value, o); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return leptWriteValue(buf, v, o)
+	}
+	return nil
+}
+
+type canonicalMember struct {
+	key []uint16
+	m   *LeptMember
+}
+
+// compareUTF16 按照 UTF-16 编码单元比较 a b，和 JavaScript 的字符串比较一致
+func compareUTF16(a, b []uint16) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
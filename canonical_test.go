@@ -0,0 +1,107 @@
+package goleptjson
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestLeptCanonicalize(t *testing.T) {
+	// RFC 8785 3.2.2 以及 3.2.3 中的例子
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		{`{
+  "numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+  "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+  "literals": [null, true, false]
+}`, "{\"literals\":[null,true,false],\"numbers\":[333333333.3333333,1e+30,4.5,0.002,1e-27],\"string\":\"€$\\u000f\\nA'B\\\"\\\\\\\\\\\"/\"}"},
+		{`{
+  "\u20ac": "Euro Sign",
+  "\r": "Carriage Return",
+  "\ufb33": "Hebrew Letter Dalet With Dagesh",
+  "1": "One",
+  "\ud83d\ude00": "Emoji: Grinning Face",
+  "\u0080": "Control",
+  "\u00f6": "Latin Small Letter O With Diaeresis"
+}`, "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"ö\":\"Latin Small Letter O With Diaeresis\",\"€\":\"Euro Sign\",\"😀\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}"},
+		{`{"b":[],"a":{"d":{},"c":"\u001f\b\t\f"}}`, `{"a":{"c":"\u001f\b\t\f","d":{}},"b":[]}`},
+		{`"\u2028<>&"`, "\"\u2028<>&\""},
+	}
+	for _, tt := range tests {
+		v := mustParse(t, tt.input)
+		actual, err := LeptCanonicalize(v)
+		if err != nil {
+			t.Errorf("LeptCanonicalize expect no err: %v", err)
+		}
+		expectEQString(t, tt.expect, string(actual))
+	}
+
+	// RFC 8785 附录 B 中数字的例子
+	numbers := []struct {
+		bits   uint64
+		expect string
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0xffefffffffffffff, "-1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+		{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x41b3de4355555554, "333333333.33333325"},
+		{0x41b3de4355555555, "333333333.3333333"},
+		{0x41b3de4355555556, "333333333.3333334"},
+		{0x41b3de4355555557, "333333333.33333343"},
+		{0xbecbf647612f3696, "-0.0000033333333333333333"},
+		{0x43143ff3c1cb0959, "1424953923781206.2"},
+	}
+	for _, tt := range numbers {
+		v := NewLeptValue()
+		LeptSetNumber(v, math.Float64frombits(tt.bits))
+		actual, err := LeptCanonicalize(v)
+		if err != nil {
+			t.Errorf("LeptCanonicalize expect no err: %v", err)
+		}
+		expectEQString(t, tt.expect, string(actual))
+	}
+
+	// key 的比较使用 UTF-16 而不是 UTF-8，U+FB33 排在代理对之后
+	v := mustParse(t, `{"\ufb33":1,"\ud83d\ude00":2}`)
+	actual, _ := LeptCanonicalize(v)
+	expectEQString(t, "{\"😀\":2,\"\ufb33\":1}", string(actual))
+
+	errs := []struct {
+		v      *LeptValue
+		expect string
+	}{
+		{mustParse(t, `{"a":1,"b":{"a":1,"a":2}}`), `LeptCanonicalize duplicate key: "a"`},
+		{mustParse(t, `{"\u00e9":1,"é":2}`), `LeptCanonicalize duplicate key: "é"`},
+		{nonFinite(math.NaN()), "unsupported value: NaN"},
+		{nonFinite(math.Inf(-1)), "unsupported value: -Inf"},
+		{mustParse(t, "[\"a\xffb\"]"), `invalid UTF-8 in string: "a\xffb"`},
+	}
+	for _, tt := range errs {
+		actual, err := LeptCanonicalize(tt.v)
+		expectEQString(t, tt.expect, fmt.Sprint(err))
+		expectEQBool(t, true, actual == nil)
+	}
+}
+
+func nonFinite(f float64) *LeptValue {
+	v := NewLeptValue()
+	LeptSetNumber(v, f)
+	return v
+}
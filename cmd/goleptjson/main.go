@@ -0,0 +1,69 @@
+// goleptjson 是 goleptjson 的命令行工具
+//
+//	goleptjson gostruct [-name Root] [-pkg main] [file]
+//
+// gostruct 读取 file 或者标准输入中的 json，输出对应的 Go 类型声明
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/lipeining/goleptjson"
+)
+
+// commands 是所有的子命令
+var commands = map[string]func(args []string, stdin io.Reader, stdout io.Writer) error{
+	"gostruct": goStruct,
+}
+
+func main() {
+	if len(os.Args) < 2 || commands[os.Args[1]] == nil {
+		fmt.Fprintln(os.Stderr, "usage: goleptjson gostruct [-name Root] [-pkg main] [file]")
+		os.Exit(2)
+	}
+	if err := commands[os.Args[1]](os.Args[2:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "goleptjson:", err)
+		os.Exit(1)
+	}
+}
+
+func goStruct(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("gostruct", flag.ContinueOnError)
+	name := fs.String("name", "Root", "name of the root type")
+	pkg := fs.String("pkg", "", "write a package clause with this name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	input, err := readInput(fs.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	v := goleptjson.NewLeptValue()
+	if event := goleptjson.LeptParse(v, string(input)); event != goleptjson.LeptParseOK {
+		return fmt.Errorf("parse json: %v", event)
+	}
+	src, err := goleptjson.LeptGenerateStructs(v, *name)
+	if err != nil {
+		return err
+	}
+	if *pkg != "" {
+		fmt.Fprintf(stdout, "package %s\n\n", *pkg)
+	}
+	_, err = stdout.Write(src)
+	return err
+}
+
+// readInput 读取 args 中唯一的文件，没有文件时读取 stdin
+func readInput(args []string, stdin io.Reader) ([]byte, error) {
+	switch len(args) {
+	case 0:
+		return ioutil.ReadAll(stdin)
+	case 1:
+		return ioutil.ReadFile(args[0])
+	}
+	return nil, fmt.Errorf("too many arguments: %v", args)
+}
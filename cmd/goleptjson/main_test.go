@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGoStruct(t *testing.T) {
+	var out bytes.Buffer
+	err := goStruct([]string{"-name", "Point", "-pkg", "geo"}, strings.NewReader(`{"x":1,"y":2.5}`), &out)
+	if err != nil {
+		t.Fatalf("gostruct expect no err: %v", err)
+	}
+	expect := "package geo\n\n" +
+		"type Point struct {\n" +
+		"\tX int64   `json:\"x\"`\n" +
+		"\tY float64 `json:\"y\"`\n" +
+		"}\n"
+	if out.String() != expect {
+		t.Errorf("expect %q, actual %q", expect, out.String())
+	}
+
+	err = goStruct(nil, strings.NewReader(`{"x":`), &out)
+	if err == nil || err.Error() != "parse json: LeptParseExpectValue" {
+		t.Errorf("expect parse error, actual %v", err)
+	}
+}
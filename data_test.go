@@ -1,10 +1,14 @@
 package goleptjson
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -80,12 +84,26 @@ func TestRoundtripJSON(t *testing.T) {
 		v := NewLeptValue()
 		event := LeptParse(v, buf)
 		expectEQBool(t, true, event == LeptParseOK)
-		// actual := LeptStringify(v)
-		// 对于大整数的处理不够灵活，可以考虑区分没有溢出的整数和浮点数
-		// expectEQString(t, buf, actual)
+		// 超过 2^53 的整数只保留最短的有效数字，和 JavaScript 的 JSON.stringify 一致
+		expect := buf
+		if e, ok := roundtripExpect[i]; ok {
+			expect = e
+		}
+		expectEQString(t, expect, LeptStringify(v))
 	}
 }
 
+// roundtripExpect 是输出和输入文本不同的 roundtrip 文件对应的输出
+var roundtripExpect = map[int]string{
+	13: "[-1234567890123456800]",
+	14: "[-9223372036854776000]",
+	18: "[1234567890123456800]",
+	19: "[9223372036854776000]",
+	20: "[0]",
+	21: "[0]",
+	27: "[1.7976931348623157e+308]",
+}
+
 func BenchmarkCanadaJSON(b *testing.B) {
 	path := filepath.Join("./data", "canada.json")
 	buf, err := readJSON(path)
@@ -149,3 +167,195 @@ func BenchmarkTwitterJSON(b *testing.B) {
 		// fmt.Println(event)
 	}
 }
+
+// twitterStruct 对应 data/twitter.json 的结构，用于比较 Marshal Unmarshal 和 encoding/json
+type twitterStruct struct {
+	Statuses       []twitterStatus       `json:"statuses"`
+	SearchMetadata twitterSearchMetadata `json:"search_metadata"`
+}
+
+type twitterStatus struct {
+	Metadata struct {
+		ResultType      string `json:"result_type"`
+		IsoLanguageCode string `json:"iso_language_code"`
+	} `json:"metadata"`
+	CreatedAt            string          `json:"created_at"`
+	ID                   int64           `json:"id"`
+	IDStr                string          `json:"id_str"`
+	Text                 string          `json:"text"`
+	Source               string          `json:"source"`
+	Truncated            bool            `json:"truncated"`
+	InReplyToStatusID    *int64          `json:"in_reply_to_status_id"`
+	InReplyToStatusIDStr *string         `json:"in_reply_to_status_id_str"`
+	InReplyToUserID      *int64          `json:"in_reply_to_user_id"`
+	InReplyToUserIDStr   *string         `json:"in_reply_to_user_id_str"`
+	InReplyToScreenName  *string         `json:"in_reply_to_screen_name"`
+	User                 twitterUser     `json:"user"`
+	Geo                  interface{}     `json:"geo"`
+	Coordinates          interface{}     `json:"coordinates"`
+	Place                interface{}     `json:"place"`
+	Contributors         interface{}     `json:"contributors"`
+	RetweetCount         int             `json:"retweet_count"`
+	FavoriteCount        int             `json:"favorite_count"`
+	Entities             twitterEntities `json:"entities"`
+	Favorited            bool            `json:"favorited"`
+	Retweeted            bool            `json:"retweeted"`
+	Lang                 string          `json:"lang"`
+}
+
+type twitterUser struct {
+	ID                   int64   `json:"id"`
+	IDStr                string  `json:"id_str"`
+	Name                 string  `json:"name"`
+	ScreenName           string  `json:"screen_name"`
+	Location             string  `json:"location"`
+	Description          string  `json:"description"`
+	URL                  *string `json:"url"`
+	Protected            bool    `json:"protected"`
+	FollowersCount       int     `json:"followers_count"`
+	FriendsCount         int     `json:"friends_count"`
+	ListedCount          int     `json:"listed_count"`
+	CreatedAt            string  `json:"created_at"`
+	FavouritesCount      int     `json:"favourites_count"`
+	UtcOffset            *int    `json:"utc_offset"`
+	TimeZone             *string `json:"time_zone"`
+	GeoEnabled           bool    `json:"geo_enabled"`
+	Verified             bool    `json:"verified"`
+	StatusesCount        int     `json:"statuses_count"`
+	Lang                 string  `json:"lang"`
+	ProfileImageURL      string  `json:"profile_image_url"`
+	ProfileImageURLHTTPS string  `json:"profile_image_url_https"`
+	Following            bool    `json:"following"`
+	FollowRequestSent    bool    `json:"follow_request_sent"`
+	Notifications        bool    `json:"notifications"`
+}
+
+type twitterEntities struct {
+	Hashtags []struct {
+		Text    string `json:"text"`
+		Indices []int  `json:"indices"`
+	} `json:"hashtags"`
+	Urls []struct {
+		URL         string `json:"url"`
+		ExpandedURL string `json:"expanded_url"`
+		DisplayURL  string `json:"display_url"`
+		Indices     []int  `json:"indices"`
+	} `json:"urls"`
+	UserMentions []struct {
+		ScreenName string `json:"screen_name"`
+		Name       string `json:"name"`
+		ID         int64  `json:"id"`
+		IDStr      string `json:"id_str"`
+		Indices    []int  `json:"indices"`
+	} `json:"user_mentions"`
+}
+
+type twitterSearchMetadata struct {
+	CompletedIn float64 `json:"completed_in"`
+	MaxID       int64   `json:"max_id"`
+	MaxIDStr    string  `json:"max_id_str"`
+	NextResults string  `json:"next_results"`
+	Query       string  `json:"query"`
+	RefreshURL  string  `json:"refresh_url"`
+	Count       int     `json:"count"`
+	SinceID     int64   `json:"since_id"`
+	SinceIDStr  string  `json:"since_id_str"`
+}
+
+func readTwitterStruct(tb testing.TB) ([]byte, *twitterStruct) {
+	path := filepath.Join("./data", "twitter.json")
+	buf, err := readJSON(path)
+	if err != nil || buf == "" {
+		tb.Fatalf("readJSON %v get err: %v", path, err)
+	}
+	structure := &twitterStruct{}
+	if err := json.Unmarshal([]byte(buf), structure); err != nil {
+		tb.Fatalf("json.Unmarshal %v get err: %v", path, err)
+	}
+	return []byte(buf), structure
+}
+
+func TestTwitterStruct(t *testing.T) {
+	buf, expect := readTwitterStruct(t)
+	// Marshal 不会转义 HTML 字符，这里关闭 encoding/json 的转义再比较
+	var ebuf bytes.Buffer
+	enc := json.NewEncoder(&ebuf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(expect); err != nil {
+		t.Fatalf("json.Encoder get err: %v", err)
+	}
+	abuf, err := Marshal(expect)
+	if err != nil {
+		t.Fatalf("Marshal get err: %v", err)
+	}
+	expectEQString(t, string(bytes.TrimSuffix(ebuf.Bytes(), []byte("\n"))), string(abuf))
+
+	actual := &twitterStruct{}
+	if err := Unmarshal(buf, actual); err != nil {
+		t.Fatalf("Unmarshal twitter.json get err: %v", err)
+	}
+	expectEQInt(t, len(expect.Statuses), len(actual.Statuses))
+	for i := 0; i < len(expect.Statuses) && i < len(actual.Statuses); i++ {
+		expectEQString(t, expect.Statuses[i].IDStr, actual.Statuses[i].IDStr)
+		// 超过 2^53 的 id 使用原始文本解析，和 encoding/json 的结果一致
+		expectEQString(t, strconv.FormatInt(expect.Statuses[i].ID, 10), strconv.FormatInt(actual.Statuses[i].ID, 10))
+		expectEQString(t, strconv.FormatInt(expect.Statuses[i].User.ID, 10), strconv.FormatInt(actual.Statuses[i].User.ID, 10))
+		if !reflect.DeepEqual(expect.Statuses[i].InReplyToStatusID, actual.Statuses[i].InReplyToStatusID) {
+			t.Errorf("Unmarshal in_reply_to_status_id expect: %v, actual: %v", expect.Statuses[i].InReplyToStatusID, actual.Statuses[i].InReplyToStatusID)
+		}
+		expectEQString(t, expect.Statuses[i].Text, actual.Statuses[i].Text)
+		expectEQString(t, expect.Statuses[i].User.ScreenName, actual.Statuses[i].User.ScreenName)
+		expectEQInt(t, len(expect.Statuses[i].Entities.UserMentions), len(actual.Statuses[i].Entities.UserMentions))
+	}
+	expectEQString(t, expect.SearchMetadata.NextResults, actual.SearchMetadata.NextResults)
+}
+
+func BenchmarkMarshalTwitterStruct(b *testing.B) {
+	_, structure := readTwitterStruct(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(structure); err != nil {
+			b.Errorf("benchmark Marshal err : %v", err)
+		}
+	}
+}
+func BenchmarkJSONMarshalTwitterStruct(b *testing.B) {
+	_, structure := readTwitterStruct(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(structure); err != nil {
+			b.Errorf("benchmark json.Marshal err : %v", err)
+		}
+	}
+}
+func BenchmarkUnmarshalTwitterStruct(b *testing.B) {
+	buf, _ := readTwitterStruct(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := Unmarshal(buf, &twitterStruct{}); err != nil {
+			b.Errorf("benchmark Unmarshal err : %v", err)
+		}
+	}
+}
+func BenchmarkToStructTwitterStruct(b *testing.B) {
+	buf, _ := readTwitterStruct(b)
+	v := NewLeptValue()
+	if event := LeptParse(v, string(buf)); event != LeptParseOK {
+		b.Fatalf("benchmark parse err : %v", event)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ToStruct(v, &twitterStruct{}); err != nil {
+			b.Errorf("benchmark ToStruct err : %v", err)
+		}
+	}
+}
+func BenchmarkJSONUnmarshalTwitterStruct(b *testing.B) {
+	buf, _ := readTwitterStruct(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := json.Unmarshal(buf, &twitterStruct{}); err != nil {
+			b.Errorf("benchmark json.Unmarshal err : %v", err)
+		}
+	}
+}
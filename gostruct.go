@@ -0,0 +1,201 @@
+package goleptjson
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// commonInitialisms 是生成字段名和类型名时全部大写的单词，例如 user_id 生成 UserID
+var commonInitialisms = map[string]bool{
+	"API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true, "EOF": true, "GUID": true,
+	"HTML": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true, "JSON": true, "OS": true,
+	"SQL": true, "SSH": true, "TCP": true, "TLS": true, "TTL": true, "UDP": true, "UI": true,
+	"URI": true, "URL": true, "UTF8": true, "UUID": true, "XML": true,
+}
+
+// LeptGenerateStructs 根据 v 生成 Go 的类型声明，根类型名为 name，结果经过 gofmt 格式化，
+// 可以直接用于 Unmarshal 或 ToStruct：
+//   - object 生成 struct，字段带有 json tag，不是每个 object 都有的 key 加上 omitempty
+//   - array 中所有元素的 object 合并为同一个 struct
+//   - 可能为 null 的字段使用指针，null 与多种类型混合时使用 interface{}
+//   - 嵌套的 struct 以 key 命名，array 元素使用 key 的单数形式，重名时加上外层类型名作为前缀
+func LeptGenerateStructs(v *LeptValue, name string) ([]byte, error) {
+	if !token.IsIdentifier(name) {
+		return nil, fmt.Errorf("invalid type name %q", name)
+	}
+	s := newInferShape()
+	s.add(v)
+	g := &structGenerator{used: map[string]bool{name: true}}
+	g.queue = append(g.queue, namedShape{name: name, shape: s})
+	for i := 0; i < len(g.queue); i++ {
+		g.decl(g.queue[i])
+	}
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %v", err)
+	}
+	return src, nil
+}
+
+type namedShape struct {
+	name  string
+	shape *inferShape
+}
+
+type structGenerator struct {
+	buf   bytes.Buffer
+	used  map[string]bool // 已经使用的类型名
+	queue []namedShape    // 需要生成声明的类型，按照第一次出现的顺序
+}
+
+// decl 写入一个类型声明
+func (g *structGenerator) decl(ns namedShape) {
+	if g.buf.Len() != 0 {
+		g.buf.WriteByte('\n')
+	}
+	s := ns.shape
+	if structShape(s) {
+		g.buf.WriteString("type " + ns.name + " struct {\n")
+		g.fields(ns.name, s)
+		g.buf.WriteString("}\n")
+		return
+	}
+	// 根类型不是 object 时，array 的元素使用根类型名的单数形式命名
+	g.buf.WriteString("type " + ns.name + " " + g.typeOf(ns.name, ns.name, s, false) + "\n")
+}
+
+// fields 写入 struct 的字段，字段名重复时加上数字后缀
+func (g *structGenerator) fields(parent string, s *inferShape) {
+	names := make(map[string]bool, len(s.propOrder))
+	for _, key := range s.propOrder {
+		p := s.props[key]
+		name := exportedName(key)
+		for i := 2; names[name]; i++ {
+			name = exportedName(key) + strconv.Itoa(i)
+		}
+		names[name] = true
+		typ := g.typeOf(parent, exportedName(key), p.shape, true)
+		tag := key
+		if p.count != s.objectCount {
+			tag += ",omitempty"
+			// omitempty 不会省略 struct，可能缺少的 struct 同样使用指针
+			if structShape(p.shape) && !strings.HasPrefix(typ, "*") {
+				typ = "*" + typ
+			}
+		}
+		fmt.Fprintf(&g.buf, "%s %s `json:%s`\n", name, typ, strconv.Quote(tag))
+	}
+}
+
+// typeOf 返回 s 对应的 Go 类型，name 是嵌套的 struct 使用的名字，
+// nullable 为 true 时可能为 null 的值使用指针
+func (g *structGenerator) typeOf(parent, name string, s *inferShape, nullable bool) string {
+	types := make([]string, 0, len(s.types))
+	for _, t := range inferTypeOrder {
+		if s.types[t] && t != "null" && !(t == "integer" && s.types["number"]) {
+			types = append(types, t)
+		}
+	}
+	if len(types) != 1 {
+		return "interface{}"
+	}
+	var typ string
+	switch types[0] {
+	case "boolean":
+		typ = "bool"
+	case "integer":
+		typ = "int64"
+	case "number":
+		typ = "float64"
+	case "string":
+		typ = "string"
+	case "array":
+		// slice 本身可以为 nil，不需要指针
+		item := singular(name)
+		if item == name {
+			item += "Item"
+		}
+		return "[]" + g.typeOf(parent, item, s.items, false)
+	case "object":
+		if !structShape(s) {
+			return "map[string]interface{}"
+		}
+		typ = g.structName(parent, name)
+		g.queue = append(g.queue, namedShape{name: typ, shape: s})
+	}
+	if nullable && s.types["null"] {
+		typ = "*" + typ
+	}
+	return typ
+}
+
+// structName 返回一个没有使用过的类型名，优先使用 name，其次加上外层类型名作为前缀
+func (g *structGenerator) structName(parent, name string) string {
+	typ := name
+	if g.used[typ] {
+		typ = parent + name
+	}
+	for i := 2; g.used[typ]; i++ {
+		typ = parent + name + strconv.Itoa(i)
+	}
+	g.used[typ] = true
+	return typ
+}
+
+// structShape 判断 s 是否只包含 object (以及 null)，并且至少有一个 key
+func structShape(s *inferShape) bool {
+	return s.types["object"] && len(s.propOrder) != 0 &&
+		(len(s.types) == 1 || len(s.types) == 2 && s.types["null"])
+}
+
+// exportedName 将 json 中的 key 转换为导出的 Go 标识符，例如 user_id 转换为 UserID，
+// 无法转换的 key 使用 Field 作为前缀
+func exportedName(key string) string {
+	// 除了字母和数字都作为分隔符
+	key = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, key)
+	var b strings.Builder
+	for _, w := range splitWords(key) {
+		up := strings.ToUpper(w)
+		if commonInitialisms[up] {
+			b.WriteString(up)
+			continue
+		}
+		// 缩写的复数形式，例如 urls 生成 URLs
+		if strings.HasSuffix(up, "S") && commonInitialisms[up[:len(up)-1]] {
+			b.WriteString(up[:len(up)-1] + "s")
+			continue
+		}
+		rs := []rune(w)
+		b.WriteRune(unicode.ToUpper(rs[0]))
+		b.WriteString(strings.ToLower(string(rs[1:])))
+	}
+	name := b.String()
+	if name == "" || !unicode.IsUpper([]rune(name)[0]) {
+		name = "Field" + name
+	}
+	return name
+}
+
+// singular 返回英文单词简单的单数形式，用于 array 元素的类型名，例如 Statuses 返回 Status
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 3:
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "uses"),
+		strings.HasSuffix(name, "xes"), strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss") && len(name) > 1:
+		return name[:len(name)-1]
+	}
+	return name
+}
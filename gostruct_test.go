@@ -0,0 +1,102 @@
+package goleptjson
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateStructs(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		{`1`, "type Root int64\n"},
+		{`[1,2.5]`, "type Root []float64\n"},
+		{`[1,"a",null]`, "type Root []interface{}\n"},
+		{`{}`, "type Root map[string]interface{}\n"},
+		{`{"user_id":1,"name":"a","tags":[],"score":null,"urls":["x"]}`,
+			"type Root struct {\n" +
+				"\tUserID int64         `json:\"user_id\"`\n" +
+				"\tName   string        `json:\"name\"`\n" +
+				"\tTags   []interface{} `json:\"tags\"`\n" +
+				"\tScore  interface{}   `json:\"score\"`\n" +
+				"\tURLs   []string      `json:\"urls\"`\n" +
+				"}\n"},
+		// array 中的 object 合并为一个 struct，可能为 null 或者缺少的 struct 使用指针，
+		// 重名的类型加上外层类型名作为前缀
+		{`{"items":[{"id":1,"owner":{"name":"a"}},{"id":2,"owner":null,"meta":{"x":1.5}}],"owner":{"id":"x"}}`,
+			"type Root struct {\n" +
+				"\tItems []Item `json:\"items\"`\n" +
+				"\tOwner Owner  `json:\"owner\"`\n" +
+				"}\n\n" +
+				"type Item struct {\n" +
+				"\tID    int64      `json:\"id\"`\n" +
+				"\tOwner *ItemOwner `json:\"owner\"`\n" +
+				"\tMeta  *Meta      `json:\"meta,omitempty\"`\n" +
+				"}\n\n" +
+				"type Owner struct {\n" +
+				"\tID string `json:\"id\"`\n" +
+				"}\n\n" +
+				"type ItemOwner struct {\n" +
+				"\tName string `json:\"name\"`\n" +
+				"}\n\n" +
+				"type Meta struct {\n" +
+				"\tX float64 `json:\"x\"`\n" +
+				"}\n"},
+		// 无法直接使用的 key
+		{`{"a-b":true,"A_B":false,"":1,"1x":"s","$ref":"r","名字":"n"}`,
+			"type Root struct {\n" +
+				"\tAB      bool   `json:\"a-b\"`\n" +
+				"\tAB2     bool   `json:\"A_B\"`\n" +
+				"\tField   int64  `json:\"\"`\n" +
+				"\tField1x string `json:\"1x\"`\n" +
+				"\tRef     string `json:\"$ref\"`\n" +
+				"\tField名字 string `json:\"名字\"`\n" +
+				"}\n"},
+		{`[{"categories":[[{"a":1}]]}]`,
+			"type Root []RootItem\n\n" +
+				"type RootItem struct {\n" +
+				"\tCategories [][]CategoryItem `json:\"categories\"`\n" +
+				"}\n\n" +
+				"type CategoryItem struct {\n" +
+				"\tA int64 `json:\"a\"`\n" +
+				"}\n"},
+	}
+	for _, tt := range tests {
+		src, err := LeptGenerateStructs(mustParse(t, tt.input), "Root")
+		if err != nil {
+			t.Errorf("LeptGenerateStructs %s expect no err: %v", tt.input, err)
+			continue
+		}
+		expectEQString(t, tt.expect, string(src))
+	}
+	_, err := LeptGenerateStructs(mustParse(t, `1`), "1Root")
+	expectEQString(t, `invalid type name "1Root"`, fmt.Sprint(err))
+}
+
+func TestGenerateStructsTwitter(t *testing.T) {
+	buf, err := readJSON(filepath.Join("./data", "twitter.json"))
+	if err != nil {
+		t.Fatalf("readJSON twitter.json get err: %v", err)
+	}
+	src, err := LeptGenerateStructs(mustParse(t, buf), "Twitter")
+	if err != nil {
+		t.Fatalf("LeptGenerateStructs expect no err: %v", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "twitter.go", "package p\n\n"+string(src), 0); err != nil {
+		t.Errorf("generated code expect to parse: %v", err)
+	}
+	for _, line := range []string{
+		"\tStatuses       []Status       `json:\"statuses\"`",
+		"\tInReplyToStatusID    *int64           `json:\"in_reply_to_status_id\"`",
+		"\tRetweetedStatus      *RetweetedStatus `json:\"retweeted_status,omitempty\"`",
+		"\tUser                 RetweetedStatusUser     `json:\"user\"`",
+		"\tCompletedIn float64 `json:\"completed_in\"`",
+	} {
+		expectEQBool(t, true, strings.Contains(string(src), line+"\n"))
+	}
+}
@@ -0,0 +1,189 @@
+package goleptjson
+
+import (
+	"math"
+	"sort"
+)
+
+// inferEnumLimit 是推断为 enum 的字符串最多有多少种不同的值，
+// 并且每个值平均至少出现两次，避免把只出现一次的 id 名字之类当作 enum
+const inferEnumLimit = 10
+
+// inferTypeOrder 是输出 type 数组时的顺序
+var inferTypeOrder = []string{"null", "boolean", "integer", "number", "string", "array", "object"}
+
+// inferShape 记录一个位置上出现过的所有值，多个样本合并到同一个 inferShape 中
+type inferShape struct {
+	types map[string]bool // 出现过的类型，和 schema 中的 type 一致
+
+	strings     map[string]bool // 不同的字符串，超过 inferEnumLimit 之后不再记录
+	stringCount int
+
+	items *inferShape // 所有 array 中的所有元素
+
+	objectCount int // object 出现的次数，key 出现的次数和它相同时是 required
+	props       map[string]*inferProp
+	propOrder   []string
+}
+
+type inferProp struct {
+	count int
+	shape *inferShape
+}
+
+func newInferShape() *inferShape {
+	return &inferShape{types: make(map[string]bool)}
+}
+
+// LeptInferSchema 根据样本推断一个 draft 2020-12 的 JSON Schema，样本之间合并：
+// 同一个位置出现过的类型合并为 type 数组，null 对应 nullable；
+// 整数和小数都出现时使用 number；所有 object 中都出现的 key 是 required；
+// array 中所有元素合并为一个 items；重复出现的少数几种字符串推断为 enum。
+// 没有样本时返回 true，也就是不做任何限制的 schema
+func LeptInferSchema(samples ...*LeptValue) *LeptValue {
+	s := newInferShape()
+	for _, v := range samples {
+		s.add(v)
+	}
+	root := NewLeptValue()
+	if len(samples) == 0 {
+		LeptSetBoolean(root, 1)
+		return root
+	}
+	LeptSetObject(root)
+	LeptSetString(LeptSetObjectValue(root, "$schema"), "https://json-schema.org/draft/2020-12/schema")
+	s.write(root)
+	return root
+}
+
+// add 将 v 合并到 s 中
+func (s *inferShape) add(v *LeptValue) {
+	switch v.typ {
+	case LeptNull:
+		s.types["null"] = true
+	case LeptTrue, LeptFalse:
+		s.types["boolean"] = true
+	case LeptNumber:
+		if v.n == math.Trunc(v.n) && !math.IsInf(v.n, 0) {
+			s.types["integer"] = true
+		} else {
+			s.types["number"] = true
+		}
+	case LeptString:
+		s.types["string"] = true
+		s.stringCount++
+		if s.strings == nil {
+			s.strings = make(map[string]bool)
+		}
+		if len(s.strings) <= inferEnumLimit {
+			s.strings[v.s] = true
+		}
+	case LeptArray:
+		s.types["array"] = true
+		if s.items == nil {
+			s.items = newInferShape()
+		}
+		for _, vi := range v.a {
+			s.items.add(vi)
+		}
+	case LeptObject:
+		s.types["object"] = true
+		s.objectCount++
+		if s.props == nil {
+			s.props = make(map[string]*inferProp)
+		}
+		seen := make(map[string]bool, len(v.o))
+		for _, m := range v.o {
+			p, ok := s.props[m.key]
+			if !ok {
+				p = &inferProp{shape: newInferShape()}
+				s.props[m.key] = p
+				s.propOrder = append(s.propOrder, m.key)
+			}
+			// 重复的 key 只计算一次
+			if !seen[m.key] {
+				seen[m.key] = true
+				p.count++
+			}
+			p.shape.add(m.value)
+		}
+	}
+}
+
+// write 将 s 对应的关键字写入 object v
+func (s *inferShape) write(v *LeptValue) {
+	if s.types["integer"] && s.types["number"] {
+		delete(s.types, "integer")
+	}
+	var types []string
+	for _, t := range inferTypeOrder {
+		if s.types[t] {
+			types = append(types, t)
+		}
+	}
+	switch len(types) {
+	case 0:
+		// 只在空 array 的 items 中出现，不做限制
+		return
+	case 1:
+		LeptSetString(LeptSetObjectValue(v, "type"), types[0])
+	default:
+		t := LeptSetObjectValue(v, "type")
+		LeptSetArray(t)
+		for _, name := range types {
+			LeptSetString(LeptPushBackArrayElement(t), name)
+		}
+	}
+	if len(types) == 1 || len(types) == 2 && s.types["null"] {
+		// 只有字符串 (以及 null) 时才使用 enum
+		if s.types["string"] && len(s.strings) <= inferEnumLimit && s.stringCount >= 2*len(s.strings) {
+			s.writeEnum(v)
+		}
+	}
+	if s.items != nil {
+		items := LeptSetObjectValue(v, "items")
+		LeptSetObject(items)
+		s.items.write(items)
+		if len(items.o) == 0 {
+			LeptSetBoolean(items, 1)
+		}
+	}
+	if s.objectCount > 0 {
+		props := LeptSetObjectValue(v, "properties")
+		LeptSetObject(props)
+		var required []string
+		for _, key := range s.propOrder {
+			p := s.props[key]
+			pv := LeptSetObjectValue(props, key)
+			LeptSetObject(pv)
+			p.shape.write(pv)
+			if p.count == s.objectCount {
+				required = append(required, key)
+			}
+		}
+		if len(required) != 0 {
+			r := LeptSetObjectValue(v, "required")
+			LeptSetArray(r)
+			for _, key := range required {
+				LeptSetString(LeptPushBackArrayElement(r), key)
+			}
+		}
+	}
+}
+
+// writeEnum 按照字典序写入出现过的字符串，nullable 时包含 null
+func (s *inferShape) writeEnum(v *LeptValue) {
+	values := make([]string, 0, len(s.strings))
+	for str := range s.strings {
+		values = append(values, str)
+	}
+	sort.Strings(values)
+	e := LeptSetObjectValue(v, "enum")
+	LeptSetArray(e)
+	for _, str := range values {
+		LeptSetString(LeptPushBackArrayElement(e), str)
+	}
+	if s.types["null"] {
+		LeptPushBackArrayElement(e)
+	}
+}
@@ -0,0 +1,83 @@
+package goleptjson
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestInferSchema(t *testing.T) {
+	const header = `{"$schema":"https://json-schema.org/draft/2020-12/schema",`
+	tests := []struct {
+		samples []string
+		expect  string
+	}{
+		{[]string{`1`, `2`}, header + `"type":"integer"}`},
+		{[]string{`1`, `2.5`}, header + `"type":"number"}`},
+		{[]string{`1`, `null`}, header + `"type":["null","integer"]}`},
+		{[]string{`"a"`, `true`}, header + `"type":["boolean","string"]}`},
+		// 重复出现的字符串推断为 enum，nullable 时包含 null
+		{[]string{`"b"`, `"a"`, `"b"`, `null`, `"a"`}, header + `"type":["null","string"],"enum":["a","b",null]}`},
+		{[]string{`"a"`, `"b"`}, header + `"type":"string"}`},
+		{[]string{`[]`}, header + `"type":"array","items":true}`},
+		{[]string{`[1,2]`, `[3.5]`}, header + `"type":"array","items":{"type":"number"}}`},
+		{[]string{`[1,"a"]`}, header + `"type":"array","items":{"type":["integer","string"]}}`},
+		// 所有 object 中都出现的 key 是 required，key 的顺序和第一次出现的顺序一致
+		{[]string{`{"id":1,"name":"a"}`, `{"id":2,"tag":null,"name":"b"}`, `{"name":"c","id":3,"tag":"x"}`},
+			header + `"type":"object","properties":{"id":{"type":"integer"},"name":{"type":"string"},"tag":{"type":["null","string"]}},"required":["id","name"]}`},
+		{[]string{`{"a":{"b":[{"c":1},{}]}}`},
+			header + `"type":"object","properties":{"a":{"type":"object","properties":{"b":{"type":"array","items":{"type":"object","properties":{"c":{"type":"integer"}}}}},"required":["b"]}},"required":["a"]}`},
+	}
+	for _, tt := range tests {
+		samples := make([]*LeptValue, len(tt.samples))
+		for i, s := range tt.samples {
+			samples[i] = mustParse(t, s)
+		}
+		schema := LeptInferSchema(samples...)
+		expectEQString(t, tt.expect, LeptStringify(schema))
+		s := mustCompile(t, schema)
+		for _, v := range samples {
+			if out := s.Validate(v); !out.Valid {
+				t.Errorf("inferred schema %s expect %s valid, errors: %v", tt.expect, LeptStringify(v), out.Errors)
+			}
+		}
+	}
+	expectEQString(t, `true`, LeptStringify(LeptInferSchema()))
+
+	s := mustCompile(t, LeptInferSchema(mustParse(t, `{"id":1,"kind":"a"}`), mustParse(t, `{"id":2,"kind":"a"}`)))
+	expectEQBool(t, false, s.Validate(mustParse(t, `{"id":1.5,"kind":"a"}`)).Valid)
+	expectEQBool(t, false, s.Validate(mustParse(t, `{"id":3,"kind":"b"}`)).Valid)
+	expectEQBool(t, false, s.Validate(mustParse(t, `{"kind":"a"}`)).Valid)
+}
+
+func TestInferSchemaTwitter(t *testing.T) {
+	buf, err := readJSON(filepath.Join("./data", "twitter.json"))
+	if err != nil {
+		t.Fatalf("readJSON twitter.json get err: %v", err)
+	}
+	twitter := mustParse(t, buf)
+	statuses := LeptFindObjectValue(twitter, "statuses")
+	schema := LeptInferSchema(statuses.a...)
+	s := mustCompile(t, schema)
+	for i, v := range statuses.a {
+		if out := s.Validate(v); !out.Valid {
+			t.Errorf("statuses/%d expect valid, errors: %v", i, out.Errors)
+		}
+	}
+	props := LeptFindObjectValue(schema, "properties")
+	expectEQString(t, `{"type":"integer"}`, LeptStringify(LeptFindObjectValue(props, "id")))
+	expectEQString(t, `{"type":["null","integer"]}`, LeptStringify(LeptFindObjectValue(props, "in_reply_to_status_id")))
+	expectEQString(t, `{"type":"string","enum":["ja","zh"]}`, LeptStringify(LeptFindObjectValue(props, "lang")))
+	expectEQBool(t, true, LeptFindObjectValue(props, "retweeted_status") != nil)
+
+	// 整个文件作为一个样本
+	s = mustCompile(t, LeptInferSchema(twitter))
+	expectEQBool(t, true, s.Validate(twitter).Valid)
+}
+
+func mustCompile(t *testing.T, schema *LeptValue) *Schema {
+	s, err := LeptCompileSchema(schema)
+	if err != nil {
+		t.Fatalf("LeptCompileSchema %s expect no err: %v", LeptStringify(schema), err)
+	}
+	return s
+}
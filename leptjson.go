@@ -2,6 +2,8 @@ package goleptjson
 
 import (
 	"bytes"
+	"encoding"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -12,6 +14,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf16"
 	"unicode/utf8"
@@ -70,6 +73,9 @@ const (
 	LeptParseMissColon
 	// LeptParseMissCommaOrCurlyBracket miss cooma or curly bracket
 	LeptParseMissCommaOrCurlyBracket
+
+	// LeptParseInvalidUTF8 string is not valid utf-8, only with UTF8Reject
+	LeptParseInvalidUTF8
 )
 
 var eventNames = []string{
@@ -87,6 +93,7 @@ var eventNames = []string{
 	"LeptParseMissKey",
 	"LeptParseMissColon",
 	"LeptParseMissCommaOrCurlyBracket",
+	"LeptParseInvalidUTF8",
 }
 
 func (event LeptEvent) String() string {
@@ -155,7 +162,7 @@ type LeptMember struct {
 type LeptValue struct {
 	typ LeptType
 	n   float64
-	s   string
+	s   string        // for string；LeptNumber 时是无法由 n 还原的原始文本，见 leptNumberText
 	a   []*LeptValue  // for array
 	o   []*LeptMember // for object
 }
@@ -169,16 +176,33 @@ func NewLeptValue() *LeptValue {
 
 // LeptContext hold the input string
 type LeptContext struct {
-	json string
+	json       string     // 剩余未解析的部分
+	src        string     // 完整的输入，用于计算 offset
+	utf8       UTF8Policy // 字符串中非法 UTF-8 的处理方式
+	numberText bool       // 小数同样保存无法由 float64 还原的原始文本，用于 Number
+	start      int        // 最近一次 LeptParseValue 解析成功的值在 src 中的开始位置
+	end        int        // 最近一次 LeptParseValue 解析成功的值在 src 中的结束位置
 }
 
 // NewLeptContext return a init LeptContext
 func NewLeptContext(json string) *LeptContext {
 	return &LeptContext{
 		json: json,
+		src:  json,
 	}
 }
 
+// Offset 返回当前解析到的位置在输入中的偏移量
+func (c *LeptContext) Offset() int {
+	return len(c.src) - len(c.json)
+}
+
+// Span 返回最近一次 LeptParseValue 解析成功的值在输入中的 [start, end)
+// 嵌套的值解析完成之后是最外层的值，input[start:end] 就是它的原始文本，不需要复制
+func (c *LeptContext) Span() (start, end int) {
+	return c.start, c.end
+}
+
 func expect(c *LeptContext, ch byte) {
 	if len(c.json) == 0 {
 		panic(ErrReachEnd)
@@ -275,11 +299,31 @@ func LeptParseNumber(c *LeptContext, v *LeptValue) LeptEvent {
 	if err != nil {
 		return LeptParseInvalidValue
 	}
+	v.s = leptNumberText(c, c.json[:len(c.json)-len(end)], v.n)
 	c.json = end
 	v.typ = LeptNumber
 	return LeptParseOK
 }
 
+// leptNumberText 返回需要保存的数字原始文本 s，只保存无法由 n 还原的文本，并且复制一份，不引用整个输入
+// 整数总是检查，保证超过 2^53 的整数解析到 int64 uint64 时不丢失精度；
+// 小数只在 c.numberText 时 (LeptParse 使用 UseNumber) 检查，否则不需要额外的分配
+func leptNumberText(c *LeptContext, s string, n float64) string {
+	isInt := strings.IndexAny(s, ".eE") < 0
+	if !isInt && !c.numberText {
+		return ""
+	}
+	if isInt && len(s) <= 15 {
+		// 不超过 15 位的整数可以由 float64 准确表示
+		return ""
+	}
+	var buf [32]byte
+	if string(leptAppendNumberLiteral(buf[:0], n)) == s {
+		return ""
+	}
+	return leptCloneString(s)
+}
+
 // strtod use to parse input string to a number
 func strtod(input string) (float64, string, error) {
 	// number = [ "-" ] int [ frac ] [ exp ]
@@ -581,7 +625,58 @@ func LeptParseString(c *LeptContext, v *LeptValue) LeptEvent {
 // quotation-mark = %x22  ; "
 // unescaped = %x20-21 / %x23-5B / %x5D-10FFFF
 func LeptParseStringRaw(c *LeptContext) (string, LeptEvent) {
+	return leptParseStringUTF8(c, false)
+}
+
+// leptParseStringUTF8 解析字符串，并按照 c.utf8 处理非法的 UTF-8
+// alias 为 true 时没有转义字符的字符串直接返回输入的子串，只能用于查找 key 等不会保存结果的地方
+func leptParseStringUTF8(c *LeptContext, alias bool) (string, LeptEvent) {
+	s, event := leptParseStringRaw(c, alias)
+	if event != LeptParseOK || c.utf8 == UTF8PassThrough || utf8.ValidString(s) {
+		return s, event
+	}
+	if c.utf8 == UTF8Reject {
+		return "", LeptParseInvalidUTF8
+	}
+	return leptReplaceInvalidUTF8(s), LeptParseOK
+}
+
+// leptReplaceInvalidUTF8 和 encoding/json 一样，每个非法的字节替换为一个 U+FFFD
+func leptReplaceInvalidUTF8(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf.WriteRune(utf8.RuneError)
+		} else {
+			buf.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return buf.String()
+}
+
+// leptCloneString 复制 s，避免保存的子串使整个输入无法回收
+func leptCloneString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	b.WriteString(s)
+	return b.String()
+}
+
+func leptParseStringRaw(c *LeptContext, alias bool) (string, LeptEvent) {
 	expect(c, '"')
+	// 没有转义字符的字符串不需要逐个字符处理，alias 时直接返回输入的子串
+	for i, n := 0, len(c.json); i < n && c.json[i] != '\\' && c.json[i] >= 0x20; i++ {
+		if c.json[i] == '"' {
+			s := c.json[:i]
+			c.json = c.json[i+1:]
+			if !alias && s != "" {
+				s = leptCloneString(s)
+			}
+			return s, LeptParseOK
+		}
+	}
 	var stack bytes.Buffer
 	defer stack.Truncate(0)
 	for i, n := 0, len(c.json); i < n; i++ {
@@ -744,7 +839,17 @@ func getu4(input string) rune {
 }
 
 // LeptParseValue use to parse value switch to spec func
+// 解析成功时，c 记录这个值在输入中的 [start, end)，可以通过 Span 取得
 func LeptParseValue(c *LeptContext, v *LeptValue) LeptEvent {
+	start := c.Offset()
+	event := leptParseValue(c, v)
+	if event == LeptParseOK {
+		c.start, c.end = start, c.Offset()
+	}
+	return event
+}
+
+func leptParseValue(c *LeptContext, v *LeptValue) LeptEvent {
 	n := len(c.json)
 	if n == 0 {
 		return LeptParseExpectValue
@@ -838,7 +943,7 @@ func LeptParseObject(c *LeptContext, v *LeptValue) LeptEvent {
 		// 	return LeptParseMissKey
 		// }
 		LeptParseWhitespace(c)
-		if c.json[0] != ':' {
+		if len(c.json) == 0 || c.json[0] != ':' {
 			return LeptParseMissColon
 		}
 		c.json = c.json[1:]
@@ -867,11 +972,16 @@ func LeptParseObject(c *LeptContext, v *LeptValue) LeptEvent {
 }
 
 // LeptParse use to parse value the enter
-func LeptParse(v *LeptValue, json string) LeptEvent {
+// 可以使用 InvalidUTF8 设置字符串中非法 UTF-8 的处理方式，
+// 使用 UseNumber 时保存小数的原始文本，之后 ToInterface 等得到的 Number 和输入一致
+func LeptParse(v *LeptValue, json string, opts ...Option) LeptEvent {
 	if v == nil {
 		panic("LeptParse v is nil")
 	}
+	o := newOptions(opts)
 	c := NewLeptContext(json)
+	c.utf8 = o.utf8
+	c.numberText = o.useNumber
 	v.typ = LeptNull
 	LeptParseWhitespace(c)
 	if ret := LeptParseValue(c, v); ret != LeptParseOK {
@@ -924,11 +1034,14 @@ func LeptGetNumber(v *LeptValue) float64 {
 }
 
 // LeptSetNumber use to set the type of value
+// n 可以是 NaN 或者 ±Infinity，NonFinite(NonFiniteJSON5) 需要 LeptValue 能够保存它们，
+// 输出时 LeptMarshal 默认返回错误，LeptStringify 写成 null
 func LeptSetNumber(v *LeptValue, n float64) {
 	if v == nil {
 		panic("LeptSetNumber v is nil ")
 	}
 	v.n = n
+	v.s = ""
 	v.typ = LeptNumber
 }
 
@@ -999,6 +1112,26 @@ func LeptGetArraySize(v *LeptValue) int {
 	return len(v.a)
 }
 
+// LeptSetArray set array value
+func LeptSetArray(v *LeptValue) {
+	if v == nil {
+		panic("LeptSetArray v is nil")
+	}
+	LeptFree(v)
+	v.a = make([]*LeptValue, 0)
+	v.typ = LeptArray
+}
+
+// LeptPushBackArrayElement 在 array 的末尾添加一个 null，返回这个新的元素
+func LeptPushBackArrayElement(v *LeptValue) *LeptValue {
+	if v == nil || v.typ != LeptArray {
+		panic("LeptPushBackArrayElement v is nil or typ is not array")
+	}
+	e := NewLeptValue()
+	v.a = append(v.a, e)
+	return e
+}
+
 // LeptGetObjectSize use to get the size of object
 func LeptGetObjectSize(v *LeptValue) int {
 	if v == nil || v.typ != LeptObject {
@@ -1044,37 +1177,277 @@ func LeptGetObjectValue(v *LeptValue, index int) *LeptValue {
 }
 
 // LeptStringify 得到紧凑的数据 string
-func LeptStringify(v *LeptValue) string {
-	return leptStringifyValue(v)
+// 可以使用 EscapeHTML EscapeASCII 设置字符串的转义方式。LeptStringify 不会失败：
+// UTF8Reject 按照 UTF8Replace 处理，NonFiniteError 按照 NonFiniteNull 处理，需要错误时使用 LeptMarshal
+func LeptStringify(v *LeptValue, opts ...Option) string {
+	o := newOptions(opts)
+	if o.utf8 == UTF8Reject {
+		o.utf8 = UTF8Replace
+	}
+	if o.nonFinite == NonFiniteError {
+		o.nonFinite = NonFiniteNull
+	}
+	var buf bytes.Buffer
+	// 上面的设置保证不会返回错误
+	leptWriteValue(&buf, v, o)
+	return buf.String()
+}
+
+// LeptMarshal 和 LeptStringify 相同，只是非法的 UTF-8 以及 NaN Infinity 按照 opts 返回错误：
+// InvalidUTF8(UTF8Reject) 时返回 *InvalidUTF8Error，数字是 NaN 或者 Infinity 时默认返回 *UnsupportedValueError
+func LeptMarshal(v *LeptValue, opts ...Option) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := leptWriteValue(&buf, v, newOptions(opts)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON 实现 json.Marshaler 以及 Marshaler，输出 LeptStringify 的结果
+func (v *LeptValue) MarshalJSON() ([]byte, error) {
+	if v == nil {
+		return []byte("null"), nil
+	}
+	return LeptMarshal(v)
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler，将 b 解析到 v 中
+// 这里的签名和本包的 Unmarshaler 不同，ToStruct 会直接复制 LeptValue
+func (v *LeptValue) UnmarshalJSON(b []byte) error {
+	LeptFree(v)
+	if event := LeptParse(v, string(b)); event != LeptParseOK {
+		LeptFree(v)
+		return fmt.Errorf("LeptValue UnmarshalJSON parse error: %v", event)
+	}
+	return nil
+}
+
+// LeptValid 检查 json 是否是一个合法的 json 值，不会生成 LeptValue
+func LeptValid(json string) LeptEvent {
+	c := NewLeptContext(json)
+	LeptParseWhitespace(c)
+	if event := leptSkipValue(c); event != LeptParseOK {
+		return event
+	}
+	LeptParseWhitespace(c)
+	if len(c.json) != 0 {
+		return LeptParseRootNotSingular
+	}
+	return LeptParseOK
+}
+
+// Number 保存一个 json 数字的原始文本，不会因为转换为 float64 丢失精度
+type Number string
+
+// String 返回数字的原始文本
+func (n Number) String() string {
+	return string(n)
+}
+
+// Float64 将数字转换为 float64
+func (n Number) Float64() (float64, error) {
+	return strconv.ParseFloat(string(n), 64)
+}
+
+// Int64 将数字转换为 int64
+func (n Number) Int64() (int64, error) {
+	return strconv.ParseInt(string(n), 10, 64)
+}
+
+// leptNumberLiteral 返回 v 的数字文本，解析时保存了原始文本的使用原始文本
+// 结果会保存到 Go 值中，v.s 可能是输入的子串 (见 decodeState.literal)，所以复制一份
+func leptNumberLiteral(v *LeptValue) Number {
+	if v.s != "" {
+		return Number(leptCloneString(v.s))
+	}
+	var buf [32]byte
+	return Number(leptAppendNumberLiteral(buf[:0], v.n))
+}
+
+// leptAppendNumberLiteral 将 n 的文本添加到 dst 中，1e21 以下的整数不使用指数，其余使用最短的表示
+func leptAppendNumberLiteral(dst []byte, n float64) []byte {
+	if n == math.Trunc(n) && math.Abs(n) < 1e21 {
+		return strconv.AppendFloat(dst, n, 'f', -1, 64)
+	}
+	return strconv.AppendFloat(dst, n, 'g', -1, 64)
+}
+
+// isValidNumber 判断 s 是否是一个合法的 json 数字
+func isValidNumber(s string) bool {
+	_, end, err := strToFloat64(s)
+	return err == nil && end == ""
+}
+
+// RawMessage 保存一个值的原始 json 文本，可以用于延迟解析或者预先计算好的 json
+// Unmarshal 和 Decoder 填入输入中的原始文本，Marshal 检查之后原样输出；
+// ToStruct 的输入是 LeptValue，没有原始文本，填入重新生成的 json：
+// 数字保存了原始文本时 (超过 2^53 的整数，LeptParse 使用 UseNumber 时的小数) 使用原始文本，
+// 其他部分和 LeptStringify 一致，空白被去掉，字符串重新转义，例如 "\u00e9" 变成 "é"
+type RawMessage []byte
+
+// MarshalJSON 返回 m，nil 对应 null
+func (m RawMessage) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("null"), nil
+	}
+	return m, nil
+}
+
+// UnmarshalJSON 将 data 复制到 m 中，和 encoding/json 的 json.Unmarshaler 一致
+func (m *RawMessage) UnmarshalJSON(data []byte) error {
+	if m == nil {
+		return errors.New("RawMessage UnmarshalJSON on nil pointer")
+	}
+	*m = append((*m)[0:0], data...)
+	return nil
+}
+
+// leptWriteNumber 按照 ECMAScript Number.prototype.toString 的规则写入 f
+// 使用能够还原 f 的最短数字，1e21 以下的整数不使用指数，-0 输出为 0
+func leptWriteNumber(buf *bytes.Buffer, f float64) {
+	if f == 0 {
+		buf.WriteByte('0')
+		return
+	}
+	var scratch [32]byte
+	// 'e' 格式为 -d.ddde±xx，取出数字部分和指数部分
+	b := strconv.AppendFloat(scratch[:0], f, 'e', -1, 64)
+	if b[0] == '-' {
+		buf.WriteByte('-')
+		b = b[1:]
+	}
+	e := bytes.IndexByte(b, 'e')
+	exp, _ := strconv.Atoi(string(b[e+1:]))
+	var digits [24]byte
+	ds := append(digits[:0], b[0])
+	if e > 1 {
+		ds = append(ds, b[2:e]...)
+	}
+	k := len(ds)
+	n := exp + 1 // f = 0.ds * 10^n
+	switch {
+	case k <= n && n <= 21:
+		buf.Write(ds)
+		for i := k; i < n; i++ {
+			buf.WriteByte('0')
+		}
+	case 0 < n && n <= 21:
+		buf.Write(ds[:n])
+		buf.WriteByte('.')
+		buf.Write(ds[n:])
+	case -6 < n && n <= 0:
+		buf.WriteString("0.")
+		for i := n; i < 0; i++ {
+			buf.WriteByte('0')
+		}
+		buf.Write(ds)
+	default:
+		buf.WriteByte(ds[0])
+		if k > 1 {
+			buf.WriteByte('.')
+			buf.Write(ds[1:])
+		}
+		buf.WriteByte('e')
+		if n-1 >= 0 {
+			buf.WriteByte('+')
+		}
+		buf.WriteString(strconv.Itoa(n - 1))
+	}
+}
+
+// leptWriteNonFinite 按照 o.nonFinite 写入 NaN 或者 ±Infinity，默认返回 *UnsupportedValueError
+func leptWriteNonFinite(buf *bytes.Buffer, f float64, o *options, rv reflect.Value) error {
+	policy := NonFiniteError
+	if o != nil {
+		policy = o.nonFinite
+	}
+	switch policy {
+	case NonFiniteNull:
+		buf.WriteString("null")
+	case NonFiniteJSON5:
+		if math.IsNaN(f) {
+			buf.WriteString("NaN")
+		} else if f > 0 {
+			buf.WriteString("Infinity")
+		} else {
+			buf.WriteString("-Infinity")
+		}
+	default:
+		return &UnsupportedValueError{Value: rv, Str: strconv.FormatFloat(f, 'g', -1, 64)}
+	}
+	return nil
 }
 
-func leptStringifyValue(v *LeptValue) string {
+// leptWriteValue 将 v 写入 buf，o 为 nil 时使用默认的转义方式
+func leptWriteValue(buf *bytes.Buffer, v *LeptValue, o *options) error {
 	switch v.typ {
 	case LeptNull:
-		return "null"
+		buf.WriteString("null")
 	case LeptFalse:
-		return "false"
+		buf.WriteString("false")
 	case LeptTrue:
-		return "true"
+		buf.WriteString("true")
 	case LeptNumber:
-		// return strconv.FormatFloat(v.n, 'g', -1, 64)
-		return strconv.FormatFloat(v.n, 'g', 17, 64)
+		if math.IsNaN(v.n) || math.IsInf(v.n, 0) {
+			return leptWriteNonFinite(buf, v.n, o, reflect.Value{})
+		}
+		if o != nil && o.numberText && v.s != "" {
+			buf.WriteString(v.s)
+		} else {
+			leptWriteNumber(buf, v.n)
+		}
 	case LeptString:
-		return leptStringifyString(v.s)
+		return leptWriteString(buf, v.s, o)
 	case LeptArray:
-		return leptStringifyArray(v)
+		buf.WriteByte('[')
+		for i, vi := range v.a {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := leptWriteValue(buf, vi, o); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
 	case LeptObject:
-		return leptStringifyObject(v)
+		buf.WriteByte('{')
+		for i, m := range v.o {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := leptWriteString(buf, m.key, o); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := leptWriteValue(buf, m.value, o); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
 	default:
 		panic("leptStringifyValue invalid type")
 	}
+	return nil
 }
 
 // leptStringifyString 考虑转义符号 unicode 字符集
 func leptStringifyString(s string) string {
 	var buf bytes.Buffer
+	// o 为 nil 时不检查 UTF-8，不会返回错误
+	leptWriteString(&buf, s, nil)
+	return buf.String()
+}
+
+const hexDigits = "0123456789ABCDEF"
+
+// leptWriteString 将转义之后的 s 直接写入 buf，避免生成中间的 string
+// o 为 nil 时只转义双引号，反斜线以及控制字符
+func leptWriteString(buf *bytes.Buffer, s string, o *options) error {
+	escapeHTML := o != nil && o.escapeHTML
+	escapeASCII := o != nil && o.escapeASCII
+	checkUTF8 := o != nil && o.utf8 != UTF8PassThrough
+	canonical := o != nil && o.canonical
 	buf.WriteByte('"')
-	hexDigits := []byte{'0', '1', '2', '3', '4', '5', '6', '7', '8', '9', 'A', 'B', 'C', 'D', 'E', 'F'}
 	for i := 0; i < len(s); i++ {
 		switch s[i] {
 		case '"':
@@ -1098,54 +1471,74 @@ func leptStringifyString(s string) string {
 		case '\t':
 			buf.WriteByte('\\')
 			buf.WriteByte('t')
+		case '<', '>', '&':
+			if escapeHTML {
+				leptWriteEscapedRune(buf, rune(s[i]))
+			} else {
+				buf.WriteByte(s[i])
+			}
 		default:
-			if s[i] < 0x20 {
+			if s[i] < 0x20 && canonical {
+				leptWriteEscapedRune(buf, rune(s[i]))
+			} else if s[i] < 0x20 {
 				buf.WriteByte('\\')
 				buf.WriteByte('u')
 				buf.WriteByte('0')
 				buf.WriteByte('0')
 				buf.WriteByte(hexDigits[s[i]>>4])
 				buf.WriteByte(hexDigits[s[i]&15])
-			} else {
+			} else if s[i] < utf8.RuneSelf || !escapeHTML && !escapeASCII && !checkUTF8 {
 				buf.WriteByte(s[i])
+			} else {
+				size, err := leptWriteNonASCII(buf, s, i, o)
+				if err != nil {
+					return err
+				}
+				i += size - 1
 			}
 		}
 	}
 	buf.WriteByte('"')
-	return buf.String()
+	return nil
 }
 
-// leptStringifyArray 考虑转义符号 unicode 字符集
-func leptStringifyArray(v *LeptValue) string {
-	var buf bytes.Buffer
-	buf.WriteByte('[')
-	n := len(v.a)
-	for i := 0; i < n; i++ {
-		buf.WriteString(leptStringifyValue(v.a[i]))
-		if i != n-1 {
-			buf.WriteByte(',')
+// leptWriteNonASCII 写入 s[i:] 开头的一个非 ASCII 字符，返回消耗的字节数
+// escapeASCII 时所有的非 ASCII 字符都写成 \uXXXX，超出 BMP 的字符使用 UTF-16 代理对；
+// 否则只转义在 <script> 中会被当作换行的 U+2028 U+2029。
+// 非法的字节按照 o.utf8 处理，UTF8Reject 时返回 *InvalidUTF8Error
+func leptWriteNonASCII(buf *bytes.Buffer, s string, i int, o *options) (int, error) {
+	r, size := utf8.DecodeRuneInString(s[i:])
+	if r == utf8.RuneError && size == 1 {
+		if o.utf8 == UTF8Reject {
+			return 0, &InvalidUTF8Error{S: s}
+		}
+		if o.utf8 == UTF8PassThrough && !o.escapeASCII {
+			buf.WriteByte(s[i])
+			return size, nil
 		}
+		// UTF8Replace 以及 EscapeASCII 时写成 \ufffd
+	} else if !o.escapeASCII && (!o.escapeHTML || r != '\u2028' && r != '\u2029') {
+		buf.WriteString(s[i : i+size])
+		return size, nil
+	}
+	if r1, r2 := utf16.EncodeRune(r); r1 != unicode.ReplacementChar {
+		leptWriteEscapedRune(buf, r1)
+		leptWriteEscapedRune(buf, r2)
+	} else {
+		leptWriteEscapedRune(buf, r)
 	}
-	buf.WriteByte(']')
-	return buf.String()
+	return size, nil
 }
 
-// leptStringifyObject 考虑转义符号 unicode 字符集
-func leptStringifyObject(v *LeptValue) string {
-	var buf bytes.Buffer
-	buf.WriteByte('{')
-	n := len(v.o)
-	for i := 0; i < n; i++ {
-		key := v.o[i].key
-		value := v.o[i].value
-		buf.WriteString(leptStringifyString(key) + ":")
-		buf.WriteString(leptStringifyValue(value))
-		if i != n-1 {
-			buf.WriteByte(',')
-		}
-	}
-	buf.WriteByte('}')
-	return buf.String()
+// leptWriteEscapedRune 将 BMP 中的 r 写成 \uXXXX，和 encoding/json 一样使用小写的十六进制
+func leptWriteEscapedRune(buf *bytes.Buffer, r rune) {
+	const lowerHex = "0123456789abcdef"
+	buf.WriteByte('\\')
+	buf.WriteByte('u')
+	buf.WriteByte(lowerHex[r>>12&0xF])
+	buf.WriteByte(lowerHex[r>>8&0xF])
+	buf.WriteByte(lowerHex[r>>4&0xF])
+	buf.WriteByte(lowerHex[r&0xF])
 }
 
 // LeptCopy copy from src to dst
@@ -1165,6 +1558,7 @@ func LeptCopy(dst, src *LeptValue) bool {
 		LeptSetBoolean(dst, 1)
 	case LeptNumber:
 		LeptSetNumber(dst, src.n)
+		dst.s = src.s
 	case LeptString:
 		LeptSetString(dst, src.s)
 	case LeptArray:
@@ -1342,8 +1736,220 @@ func LeptRemoveObjectValue(v *LeptValue, index int) {
 	v.o = next
 }
 
+// Option 用于设置 ToInterface ToStruct Unmarshal 等函数的行为
+type Option func(*options)
+
+// options 保存所有 Option 的设置，默认值由 newOptions 设置
+type options struct {
+	useNumber             bool
+	disallowUnknownFields bool
+	sortKeys              bool // map 的 key 按照字符串排序
+	escapeHTML            bool // 字符串中的 < > & U+2028 U+2029 使用 \uXXXX 转义
+	escapeASCII           bool // 字符串中所有的非 ASCII 字符使用 \uXXXX 转义
+	utf8                  UTF8Policy
+	canonical             bool // RFC 8785 的最少转义，控制字符使用小写的十六进制
+	nonFinite             NonFinitePolicy
+	naming                NamingStrategy
+	defaultOnNull         bool // 值为 null 时同样使用 default tag 的值
+	validate              bool // 解析之后使用 validate tag 检查结果
+	numberText            bool // 数字保存了原始文本时原样写入，用于 ToStruct 的 RawMessage
+
+	// 自定义 naming 转换之后的字段，见 typeFields
+	namedFields map[reflect.Type]*structFields
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{sortKeys: true}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// UseNumber 解析到 interface{} 的数字使用 Number 而不是 float64
+func UseNumber() Option {
+	return func(o *options) {
+		o.useNumber = true
+	}
+}
+
+// EscapeHTML 字符串中的 < > & U+2028 U+2029 使用 \uXXXX 转义，可以安全地嵌入 <script> 中
+func EscapeHTML() Option {
+	return func(o *options) {
+		o.escapeHTML = true
+	}
+}
+
+// EscapeASCII 字符串中所有的非 ASCII 字符使用 \uXXXX 转义，超出 BMP 的字符使用 UTF-16 代理对
+func EscapeASCII() Option {
+	return func(o *options) {
+		o.escapeASCII = true
+	}
+}
+
+// UTF8Policy 是字符串中非法 UTF-8 的处理方式，解析和输出使用同样的设置
+type UTF8Policy int
+
+const (
+	// UTF8PassThrough 原样保留非法的字节，这是默认的行为
+	UTF8PassThrough UTF8Policy = iota
+	// UTF8Replace 每个非法的字节替换为 U+FFFD
+	UTF8Replace
+	// UTF8Reject 解析时返回 LeptParseInvalidUTF8，输出时返回 InvalidUTF8Error
+	UTF8Reject
+)
+
+// InvalidUTF8 设置字符串中非法 UTF-8 的处理方式
+func InvalidUTF8(policy UTF8Policy) Option {
+	return func(o *options) {
+		o.utf8 = policy
+	}
+}
+
+// InvalidUTF8Error 是 UTF8Reject 时输出的字符串中有非法 UTF-8 的错误
+type InvalidUTF8Error struct {
+	S string
+}
+
+func (e *InvalidUTF8Error) Error() string {
+	return fmt.Sprintf("invalid UTF-8 in string: %q", e.S)
+}
+
+// NonFinitePolicy 是输出 NaN 以及 ±Infinity 的方式，json 中没有对应的数字
+type NonFinitePolicy int
+
+const (
+	// NonFiniteError 返回 *UnsupportedValueError，这是默认的行为
+	NonFiniteError NonFinitePolicy = iota
+	// NonFiniteNull 输出 null，和 JavaScript 的 JSON.stringify 一致
+	NonFiniteNull
+	// NonFiniteJSON5 输出 JSON5 中的 NaN Infinity -Infinity，结果不再是合法的 json
+	NonFiniteJSON5
+)
+
+// NonFinite 设置 Marshal LeptStringify 输出 NaN 以及 ±Infinity 的方式
+func NonFinite(policy NonFinitePolicy) Option {
+	return func(o *options) {
+		o.nonFinite = policy
+	}
+}
+
+// UnsupportedValueError 是输出不能表示为 json 的值时的错误，例如 NaN 和 ±Infinity
+// 对于 LeptValue 中的数字，Value 是零值
+type UnsupportedValueError struct {
+	Value reflect.Value
+	Str   string
+}
+
+func (e *UnsupportedValueError) Error() string {
+	return "unsupported value: " + e.Str
+}
+
+// UnsupportedTypeError 是 Marshal 遇到无法编码的类型时的错误，例如 chan func complex128
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "unsupported type: " + e.Type.String()
+}
+
+// DefaultOnNull 解析到 struct 时，值为 null 的字段和 key 不存在一样使用 default tag 的值
+func DefaultOnNull() Option {
+	return func(o *options) {
+		o.defaultOnNull = true
+	}
+}
+
+// NamingStrategy 将 struct 的字段名转换为 json 中的 key，只作用于 tag 中没有指定名字的字段
+// 转换的结果按照类型缓存，内置的函数全局缓存，自定义的函数在一次 Marshal Unmarshal 或者同一个 Encoder Decoder 中缓存，
+// 所以结果只能依赖 name，不能依赖闭包中会变化的变量
+type NamingStrategy func(name string) string
+
+// FieldNaming 设置 Marshal 以及解析到 struct 时使用的 NamingStrategy，
+// 可以使用 IdentityNaming LowerCamelCase SnakeCase KebabCase ScreamingSnakeCase 或者自定义的函数
+func FieldNaming(strategy NamingStrategy) Option {
+	return func(o *options) {
+		o.naming = strategy
+		o.namedFields = nil
+	}
+}
+
+// IdentityNaming 直接使用字段名，和不设置 NamingStrategy 相同
+func IdentityNaming(name string) string {
+	return name
+}
+
+// LowerCamelCase 将 UserID 转换为 userID，开头的缩写整体小写，例如 HTTPServer 转换为 httpServer
+func LowerCamelCase(name string) string {
+	words := splitWords(name)
+	if len(words) == 0 {
+		return name
+	}
+	words[0] = strings.ToLower(words[0])
+	return strings.Join(words, "")
+}
+
+// SnakeCase 将 UserID 转换为 user_id
+func SnakeCase(name string) string {
+	return strings.ToLower(strings.Join(splitWords(name), "_"))
+}
+
+// KebabCase 将 UserID 转换为 user-id
+func KebabCase(name string) string {
+	return strings.ToLower(strings.Join(splitWords(name), "-"))
+}
+
+// ScreamingSnakeCase 将 UserID 转换为 USER_ID
+func ScreamingSnakeCase(name string) string {
+	return strings.ToUpper(strings.Join(splitWords(name), "_"))
+}
+
+// splitWords 按照大小写将 Go 的标识符拆分为单词，连续的大写字母视为一个缩写，
+// 数字跟随前面的单词，已有的 _ - 同样作为分隔符，例如 XMLHttpRequest2 拆分为 XML Http Request2
+func splitWords(name string) []string {
+	var words []string
+	rs := []rune(name)
+	start := 0
+	for i := 0; i < len(rs); i++ {
+		if rs[i] == '_' || rs[i] == '-' {
+			if start < i {
+				words = append(words, string(rs[start:i]))
+			}
+			start = i + 1
+			continue
+		}
+		if i == start || !unicode.IsUpper(rs[i]) {
+			continue
+		}
+		prev := rs[i-1]
+		// aB 中的 B，以及 ABc 中的 B 开始一个新的单词
+		if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+			unicode.IsUpper(prev) && i+1 < len(rs) && unicode.IsLower(rs[i+1]) {
+			words = append(words, string(rs[start:i]))
+			start = i
+		}
+	}
+	if start < len(rs) {
+		words = append(words, string(rs[start:]))
+	}
+	return words
+}
+
+// DisallowUnknownFields 解析到 struct 时，object 中有 struct 不存在的 key 返回错误
+func DisallowUnknownFields() Option {
+	return func(o *options) {
+		o.disallowUnknownFields = true
+	}
+}
+
 // ToInterface transfer the LeptValue to golang interface{}
-func ToInterface(v *LeptValue) interface{} {
+// 数字默认转换为 float64，使用 UseNumber 时转换为 Number
+func ToInterface(v *LeptValue, opts ...Option) interface{} {
+	return toInterface(v, newOptions(opts))
+}
+
+func toInterface(v *LeptValue, o *options) interface{} {
 	if v == nil {
 		panic("ToInterface v is nil")
 	}
@@ -1355,20 +1961,27 @@ func ToInterface(v *LeptValue) interface{} {
 	case LeptTrue:
 		return true
 	case LeptNumber:
+		if o.useNumber {
+			return leptNumberLiteral(v)
+		}
 		return v.n
 	case LeptString:
 		return v.s
 	case LeptArray:
-		return ToArray(v)
+		return toArray(v, o)
 	case LeptObject:
-		return ToMap(v)
+		return toMap(v, o)
 	default:
 		panic("toInterface v typ error")
 	}
 }
 
 // ToMap transafer the LeptValue to a golang map[string]interface
-func ToMap(v *LeptValue) map[string]interface{} {
+func ToMap(v *LeptValue, opts ...Option) map[string]interface{} {
+	return toMap(v, newOptions(opts))
+}
+
+func toMap(v *LeptValue, o *options) map[string]interface{} {
 	if v == nil || v.typ != LeptObject {
 		panic("ToMap v is nil or typ is not object")
 	}
@@ -1376,26 +1989,30 @@ func ToMap(v *LeptValue) map[string]interface{} {
 	m := make(map[string]interface{}, size)
 	for i := 0; i < size; i++ {
 		member := v.o[i]
-		m[member.key] = ToInterface(member.value)
+		m[member.key] = toInterface(member.value, o)
 	}
 	return m
 }
 
 // ToArray transafer the LeptValue to a golang []interface
-func ToArray(v *LeptValue) []interface{} {
+func ToArray(v *LeptValue, opts ...Option) []interface{} {
+	return toArray(v, newOptions(opts))
+}
+
+func toArray(v *LeptValue, o *options) []interface{} {
 	if v == nil || v.typ != LeptArray {
 		panic("ToArray v is nil or typ is not array")
 	}
 	size := len(v.a)
 	arr := make([]interface{}, size)
 	for i := 0; i < size; i++ {
-		arr[i] = ToInterface(v.a[i])
+		arr[i] = toInterface(v.a[i], o)
 	}
 	return arr
 }
 
 // ToStruct transfer the LeptValue to a struct{} or []struct{}
-func ToStruct(v *LeptValue, structure interface{}) error {
+func ToStruct(v *LeptValue, structure interface{}, opts ...Option) error {
 	rv := reflect.ValueOf(structure)
 	if !rv.IsValid() {
 		return fmt.Errorf("structure value is not valid")
@@ -1403,7 +2020,14 @@ func ToStruct(v *LeptValue, structure interface{}) error {
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return fmt.Errorf("structure is not a ptr: %v", reflect.TypeOf(v))
 	}
-	return toValue(v, rv)
+	d := &decodeState{opts: newOptions(opts)}
+	if err := d.toValue(v, rv, fieldOptions{}); err != nil {
+		return err
+	}
+	if d.opts.validate {
+		return validateValue(rv, d.opts)
+	}
+	return nil
 	// rv = rv.Elem()
 	// 这里在对应的方法体内使用 indirect 处理 ptr
 	// if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
@@ -1427,9 +2051,9 @@ type Unmarshaler interface {
 
 // indirect walks down v allocating pointers as needed,
 // until it gets to a non-pointer.
-// if it encounters an Unmarshaler, indirect stops and returns that.
+// if it encounters an Unmarshaler or encoding.TextUnmarshaler, indirect stops and returns that.
 // if decodingNull is true, indirect stops at the last pointer so it can be set to nil.
-func indirect(v reflect.Value, decodingNull bool) (Unmarshaler, reflect.Value) {
+func indirect(v reflect.Value, decodingNull bool) (Unmarshaler, encoding.TextUnmarshaler, reflect.Value) {
 	// If v is a named type and is addressable,
 	// start with its address, so that if the type has pointer methods,
 	// we find them.
@@ -1458,42 +2082,113 @@ func indirect(v reflect.Value, decodingNull bool) (Unmarshaler, reflect.Value) {
 		}
 		if v.Type().NumMethod() > 0 {
 			if u, ok := v.Interface().(Unmarshaler); ok {
-				return u, reflect.Value{}
+				return u, nil, reflect.Value{}
+			}
+			// null 不需要经过 UnmarshalText，和 encoding/json 保持一致
+			if !decodingNull {
+				if u, ok := v.Interface().(encoding.TextUnmarshaler); ok {
+					return nil, u, reflect.Value{}
+				}
 			}
 		}
 		v = v.Elem()
 	}
-	return nil, v
+	return nil, nil, v
 }
-func toValue(v *LeptValue, rv reflect.Value) error {
-	// if rv.Kind() == reflect.Ptr {
-	// 	rv = rv.Elem()
-	// }
+
+// leptUnmarshalText 只接受 LeptString 交给 encoding.TextUnmarshaler 处理
+func leptUnmarshalText(v *LeptValue, ut encoding.TextUnmarshaler) error {
+	if v == nil {
+		return nil
+	}
+	if v.typ != LeptString {
+		return fmt.Errorf("v LeptValue is not a string: %v", v.typ)
+	}
+	return ut.UnmarshalText([]byte(v.s))
+}
+
+// decoderFunc 是某个类型的解析函数，由 typeDecoder 按类型缓存
+type decoderFunc func(d *decodeState, v *LeptValue, rv reflect.Value, opts fieldOptions) error
+
+var decoderCache sync.Map // map[reflect.Type]decoderFunc
+
+func (d *decodeState) toValue(v *LeptValue, rv reflect.Value, opts fieldOptions) error {
 	if !rv.IsValid() {
 		return fmt.Errorf("v is not valid")
 	}
-	// 针对自定义类型，需要判断是否有 UnmarshalJSON 方法
+	return typeDecoder(rv.Type())(d, v, rv, opts)
+}
+
+// typeDecoder 返回 t 的解析函数，每个类型只会判断一次是否需要经过 indirect
+func typeDecoder(t reflect.Type) decoderFunc {
+	if f, ok := decoderCache.Load(t); ok {
+		return f.(decoderFunc)
+	}
+	var f decoderFunc = (*decodeState).decodeValue
+	// 指针和接口需要分配或者取出其中的值，自定义的 UnmarshalJSON UnmarshalText 可能是指针方法
+	if t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface ||
+		reflect.PtrTo(t).Implements(unmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		f = indirectDecoder
+	}
+	fi, _ := decoderCache.LoadOrStore(t, f)
+	return fi.(decoderFunc)
+}
+
+// indirectDecoder 使用 indirect 找到 Unmarshaler encoding.TextUnmarshaler 或者最终的值
+func indirectDecoder(d *decodeState, v *LeptValue, rv reflect.Value, opts fieldOptions) error {
 	decodingNull := v != nil && v.typ == LeptNull
-	u, pv := indirect(rv, decodingNull)
+	u, ut, pv := indirect(rv, decodingNull)
 	if u != nil {
-		err := u.UnmarshalJSON(v, pv)
-		return err
+		return u.UnmarshalJSON(v, pv)
+	}
+	if ut != nil {
+		return leptUnmarshalText(v, ut)
+	}
+	return d.decodeValue(v, pv, opts)
+}
+
+// decodeValue 按照 rv 的 Kind 解析，rv 已经不需要经过 indirect
+func (d *decodeState) decodeValue(v *LeptValue, rv reflect.Value, opts fieldOptions) error {
+	decodingNull := v != nil && v.typ == LeptNull
+	if rv.Type() == leptValueType {
+		return toLeptValue(v, rv)
+	}
+	if rv.Type() == rawMessageType {
+		return toRawMessage(v, rv)
+	}
+	// Marshal 将 nil slice map 编码为 null，这里对应地设置为 nil
+	if decodingNull && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Map) {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 &&
+		!opts.byteArray && v != nil && v.typ == LeptString {
+		return toBytes(v, rv)
+	}
+	if opts.quoted && v != nil {
+		switch rv.Kind() {
+		case reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64,
+			reflect.String:
+			return d.toQuotedValue(v, rv)
+		}
 	}
-	rv = pv
 	if rv.Kind() == reflect.Array || rv.Kind() == reflect.Slice {
-		return toSlice(v, rv)
+		return d.toSlice(v, rv)
 	} else if rv.Kind() == reflect.Struct {
-		return toStruct(v, rv)
+		return d.toStruct(v, rv)
 	} else if rv.Kind() == reflect.Map {
-		return toMap(v, rv)
+		return d.toMap(v, rv)
 	}
 	// 这里开始，应该只有  bool, string, number
 	// fmt.Println(rv.Type()) // goleptjson.LeptEvent
 	// 可以传入自定义的 LeptEvent 对应的 Kind 还是包含在基本的 Kind 枚举中
 	switch rv.Kind() {
 	case reflect.Ptr:
-		// 对应的 v 为 LeptNull 时， decodingNull = true
-		fmt.Println("toValue got reflect.Ptr of v ", v)
+		// 对应的 v 为 LeptNull 时， decodingNull = true，indirect 停在最后一个指针上
+		rv.Set(reflect.Zero(rv.Type()))
 	case reflect.Interface:
 		// 可能对应的 rv 为 []interface{} interface{}
 		// fmt.Println("toValue got reflect.Interface of v ", v, rv)
@@ -1512,16 +2207,20 @@ func toValue(v *LeptValue, rv reflect.Value) error {
 			case LeptTrue:
 				rv.Set(reflect.ValueOf(true))
 			case LeptNumber:
-				rv.Set(reflect.ValueOf(v.n))
+				if d.opts.useNumber {
+					rv.Set(reflect.ValueOf(leptNumberLiteral(v)))
+				} else {
+					rv.Set(reflect.ValueOf(v.n))
+				}
 			case LeptString:
 				rv.Set(reflect.ValueOf(v.s))
 			case LeptArray:
 				rvt := reflect.MakeSlice(reflect.SliceOf(rv.Type()), len(v.a), len(v.a))
-				toSlice(v, rvt)
+				d.toSlice(v, rvt)
 				rv.Set(rvt)
 			case LeptObject:
 				rvt := reflect.MakeMap(reflect.MapOf(reflect.TypeOf("abc"), rv.Type()))
-				toMap(v, rvt)
+				d.toMap(v, rvt)
 				rv.Set(rvt)
 			default:
 				rv.Set(reflect.Zero(rv.Type()))
@@ -1541,15 +2240,23 @@ func toValue(v *LeptValue, rv reflect.Value) error {
 		if v == nil {
 			rv.SetInt(0)
 		} else if v.typ == LeptNumber {
-			rv.SetInt(int64(v.n))
+			n, err := leptNumberToInt(v, rv)
+			if err != nil {
+				return err
+			}
+			rv.SetInt(n)
 		} else {
 			return fmt.Errorf("v LeptValue is not a number: %v", v.typ)
 		}
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		if v == nil {
 			rv.SetUint(0)
 		} else if v.typ == LeptNumber {
-			rv.SetUint(uint64(v.n))
+			n, err := leptNumberToUint(v, rv)
+			if err != nil {
+				return err
+			}
+			rv.SetUint(n)
 		} else {
 			return fmt.Errorf("v LeptValue is not a number: %v", v.typ)
 		}
@@ -1557,6 +2264,9 @@ func toValue(v *LeptValue, rv reflect.Value) error {
 		if v == nil {
 			rv.SetFloat(0)
 		} else if v.typ == LeptNumber {
+			if rv.OverflowFloat(v.n) {
+				return fmt.Errorf("v LeptValue number %v overflows %v", v.n, rv.Type())
+			}
 			rv.SetFloat(float64(v.n))
 		} else {
 			return fmt.Errorf("v LeptValue is not a number: %v", v.typ)
@@ -1564,6 +2274,10 @@ func toValue(v *LeptValue, rv reflect.Value) error {
 	case reflect.String:
 		if v == nil {
 			rv.SetString("")
+		} else if rv.Type() == numberType && v.typ == LeptNumber {
+			rv.SetString(string(leptNumberLiteral(v)))
+		} else if rv.Type() == numberType && v.typ == LeptString && !isValidNumber(v.s) {
+			return fmt.Errorf("v LeptValue string %q is not a valid number", v.s)
 		} else if v.typ == LeptString {
 			rv.SetString(v.s)
 		} else {
@@ -1582,67 +2296,442 @@ func toValue(v *LeptValue, rv reflect.Value) error {
 	// fmt.Println(rv)
 	return nil
 }
-func parseTag(tag string) (string, string) {
+
+// toLeptValue 将 v 的深拷贝保存到 LeptValue 类型的 rv 中，v 之后的修改不会影响 rv
+func toLeptValue(v *LeptValue, rv reflect.Value) error {
+	dst := rv.Addr().Interface().(*LeptValue)
+	if v == nil || v == dst {
+		return nil
+	}
+	LeptFree(dst)
+	if !LeptCopy(dst, v) {
+		return fmt.Errorf("v LeptValue copy error: %v", v.typ)
+	}
+	if dst.typ == LeptNumber && dst.s != "" {
+		// Unmarshal 中数字的原始文本是输入的子串
+		dst.s = leptCloneString(dst.s)
+	}
+	return nil
+}
+
+// toRawMessage 将 v 生成的 json 保存到 RawMessage 类型的 rv 中，数字使用保存的原始文本，不丢失精度
+func toRawMessage(v *LeptValue, rv reflect.Value) error {
+	if v == nil {
+		return nil
+	}
+	o := newOptions(nil)
+	o.numberText = true
+	o.nonFinite = NonFiniteNull
+	var buf bytes.Buffer
+	if err := leptWriteValue(&buf, v, o); err != nil {
+		return err
+	}
+	rv.SetBytes(append(rv.Bytes()[0:0], buf.Bytes()...))
+	return nil
+}
+
+// leptNumberIntText 返回整数的十进制文本，整数的原始文本直接使用，保证超过 2^53 的整数不丢失精度；
+// 小数和指数形式 (1.0 1e3) 由 n 得到，n 不是整数时返回错误
+func leptNumberIntText(v *LeptValue, rv reflect.Value) (string, error) {
+	if v.s != "" && strings.IndexAny(v.s, ".eE") < 0 {
+		return v.s, nil
+	}
+	if v.n != math.Trunc(v.n) || math.IsInf(v.n, 0) {
+		return "", fmt.Errorf("v LeptValue number %v is not an integer: %v", v.n, rv.Type())
+	}
+	return strconv.FormatFloat(v.n, 'f', -1, 64), nil
+}
+
+// leptNumberToInt 检查 v 是整数，并且在 rv 的 int 类型范围内
+func leptNumberToInt(v *LeptValue, rv reflect.Value) (int64, error) {
+	s, err := leptNumberIntText(v, rv)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || rv.OverflowInt(i) {
+		return 0, fmt.Errorf("v LeptValue number %v overflows %v", s, rv.Type())
+	}
+	return i, nil
+}
+
+// leptNumberToUint 检查 v 是非负整数，并且在 rv 的 uint 类型范围内
+func leptNumberToUint(v *LeptValue, rv reflect.Value) (uint64, error) {
+	s, err := leptNumberIntText(v, rv)
+	if err != nil {
+		return 0, err
+	}
+	if s == "-0" {
+		s = "0"
+	}
+	u, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || rv.OverflowUint(u) {
+		return 0, fmt.Errorf("v LeptValue number %v overflows %v", s, rv.Type())
+	}
+	return u, nil
+}
+
+// tagOptions 是 json tag 中 name 之后逗号分隔的选项
+type tagOptions string
+
+// Contains 判断 o 中是否有 name 这个选项
+func (o tagOptions) Contains(name string) bool {
+	s := string(o)
+	for s != "" {
+		var next string
+		if idx := strings.Index(s, ","); idx != -1 {
+			s, next = s[:idx], s[idx+1:]
+		}
+		if s == name {
+			return true
+		}
+		s = next
+	}
+	return false
+}
+
+// fieldOptions 是 tag 中作用于字段值本身的选项，不会传递给 slice map 的元素
+type fieldOptions struct {
+	// byteArray 对应 json:",array"，[]byte 使用数字数组，而不是 base64 字符串
+	byteArray bool
+	// quoted 对应 json:",string"，bool number string 的值再包一层 json 字符串
+	quoted bool
+}
+
+func parseTag(tag string) (string, tagOptions) {
 	if idx := strings.Index(tag, ","); idx != -1 {
-		return tag[:idx], tag[idx+1:]
+		return tag[:idx], tagOptions(tag[idx+1:])
 	}
 	return tag, ""
 }
-func toStruct(v *LeptValue, rv reflect.Value) error {
+
+// parseFieldOptions 和 encoding/json 一样，string 选项只对 bool number string
+// 以及指向它们的指针起作用
+func parseFieldOptions(opts tagOptions, ft reflect.Type) fieldOptions {
+	fo := fieldOptions{
+		byteArray: opts.Contains("array"),
+	}
+	if opts.Contains("string") {
+		if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		switch ft.Kind() {
+		case reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64,
+			reflect.String:
+			fo.quoted = true
+		}
+	}
+	return fo
+}
+
+// field 是 struct 中参与编码解码的一个字段，由 cachedTypeFields 按类型缓存
+type field struct {
+	name      string // json 中的 key，tag 没有指定时使用字段名
+	nameJSON  string // 编码之后的 "name":
+	tagged    bool   // name 是否由 tag 指定，指定的名字不受 NamingStrategy 影响
+	index     int
+	typ       reflect.Type
+	omitEmpty bool
+	omitZero  bool
+	opts      fieldOptions
+	encoder   encoderFunc
+
+	// isZero 是 omitzero 使用的判断，字段类型有 IsZero() bool 方法时调用该方法，否则为 nil
+	isZero func(reflect.Value) bool
+
+	// defaultValue 是 default tag 解析得到的值，解析时 key 不存在的字段使用它的副本
+	defaultValue *LeptValue
+}
+
+// newDefault 返回 defaultValue 的副本，没有 default tag 时返回 nil
+// defaultValue 在缓存中共享，Unmarshaler 可能修改传入的 LeptValue，所以每次都复制
+func (f *field) newDefault() *LeptValue {
+	if f.defaultValue == nil {
+		return nil
+	}
+	v := NewLeptValue()
+	LeptCopy(v, f.defaultValue)
+	return v
+}
+
+// omit 判断编码时是否省略字段的值 fv，omitempty 使用 isEmptyValue，
+// omitzero 优先使用 IsZero() bool 方法，否则判断是否为类型的零值，和 Go 1.24 的 encoding/json 一致
+func (f *field) omit(fv reflect.Value) bool {
+	if f.omitEmpty && isEmptyValue(fv) {
+		return true
+	}
+	if f.omitZero {
+		if f.isZero != nil {
+			return f.isZero(fv)
+		}
+		return fv.IsZero()
+	}
+	return false
+}
+
+// isZeroFunc 返回调用 t 的 IsZero() bool 方法的函数，t 没有这个方法时返回 nil，
+// nil 接口和 nil 指针视为零值，避免调用方法时 panic
+func isZeroFunc(t reflect.Type) func(reflect.Value) bool {
+	switch {
+	case t.Kind() == reflect.Interface && t.Implements(isZeroerType):
+		return func(v reflect.Value) bool {
+			return v.IsNil() ||
+				v.Elem().Kind() == reflect.Ptr && v.Elem().IsNil() ||
+				v.Interface().(isZeroer).IsZero()
+		}
+	case t.Kind() == reflect.Ptr && t.Implements(isZeroerType):
+		return func(v reflect.Value) bool {
+			return v.IsNil() || v.Interface().(isZeroer).IsZero()
+		}
+	case t.Implements(isZeroerType):
+		return func(v reflect.Value) bool {
+			return v.Interface().(isZeroer).IsZero()
+		}
+	case reflect.PtrTo(t).Implements(isZeroerType):
+		return func(v reflect.Value) bool {
+			if !v.CanAddr() {
+				// 复制一份以便取得地址
+				v2 := reflect.New(v.Type()).Elem()
+				v2.Set(v)
+				v = v2
+			}
+			return v.Addr().Interface().(isZeroer).IsZero()
+		}
+	}
+	return nil
+}
+
+// structFields 是一个 struct 类型的全部字段
+type structFields struct {
+	list   []field
+	byName map[string]int // name 对应 list 的下标，重复的 name 以第一个字段为准
+	err    error          // 第一个无法解析的 default tag，解析到这个类型时返回
+}
+
+var fieldCache sync.Map // map[reflect.Type]*structFields
+
+// cachedTypeFields 和 typeFields 一样，但是使用 fieldCache 缓存结果
+func cachedTypeFields(t reflect.Type) *structFields {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(*structFields)
+	}
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return f.(*structFields)
+}
+
+// typeFields 解析 t 的每个字段的 json tag，跳过未导出以及 json:"-" 的字段
+// 这里没有考虑到 嵌套匿名字段 的处理
+func typeFields(t reflect.Type) *structFields {
+	fields := &structFields{byName: make(map[string]int)}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+		tagged := name != ""
+		if !tagged {
+			name = sf.Name
+		}
+		if _, ok := fields.byName[name]; !ok {
+			fields.byName[name] = len(fields.list)
+		}
+		defaultValue, err := parseDefaultTag(sf)
+		if err != nil && fields.err == nil {
+			fields.err = err
+		}
+		fields.list = append(fields.list, field{
+			name:         name,
+			nameJSON:     leptStringifyString(name) + ":",
+			tagged:       tagged,
+			index:        i,
+			typ:          sf.Type,
+			omitEmpty:    opts.Contains("omitempty"),
+			omitZero:     opts.Contains("omitzero"),
+			opts:         parseFieldOptions(opts, sf.Type),
+			defaultValue: defaultValue,
+		})
+		if opts.Contains("omitzero") {
+			fields.list[len(fields.list)-1].isZero = isZeroFunc(sf.Type)
+		}
+	}
+	for i := range fields.list {
+		fields.list[i].encoder = typeEncoder(fields.list[i].typ)
+	}
+	return fields
+}
+
+// parseDefaultTag 使用 LeptParse 解析 default tag，例如 default:"8080" default:"[1,2]"
+// string 类型的字段可以省略引号，default:"localhost" 和 default:"\"localhost\"" 相同，
+// 其余类型的字段不是合法的 json 时返回错误
+func parseDefaultTag(sf reflect.StructField) (*LeptValue, error) {
+	s, ok := sf.Tag.Lookup("default")
+	if !ok {
+		return nil, nil
+	}
+	v := NewLeptValue()
+	if event := LeptParse(v, s); event != LeptParseOK {
+		t := sf.Type
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.String {
+			return nil, fmt.Errorf("invalid default tag of field %s: %v", sf.Name, event)
+		}
+		LeptSetString(v, s)
+	}
+	return v, nil
+}
+
+// namedFieldsKey 是 namedFieldCache 的 key，naming 是内置 NamingStrategy 的序号
+type namedFieldsKey struct {
+	t      reflect.Type
+	naming int
+}
+
+var namedFieldCache sync.Map // map[namedFieldsKey]*structFields
+
+// builtinNamings 是可以全局缓存的 NamingStrategy，自定义的函数可能是同一个函数字面量得到的不同闭包，
+// 函数地址相同但是结果不同，所以不能按照地址全局缓存
+var builtinNamings = []NamingStrategy{IdentityNaming, LowerCamelCase, SnakeCase, KebabCase, ScreamingSnakeCase}
+
+// builtinNaming 返回 naming 在 builtinNamings 中的序号，不是内置的函数时返回 -1
+func builtinNaming(naming NamingStrategy) int {
+	p := reflect.ValueOf(naming).Pointer()
+	for i, b := range builtinNamings {
+		if reflect.ValueOf(b).Pointer() == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// typeFields 返回 t 在 o 下的字段，设置了 naming 时 tag 没有指定名字的字段使用转换之后的名字
+// 内置的 naming 按照 t 缓存在 namedFieldCache 中，自定义的 naming 缓存在 o.namedFields 中
+func (o *options) typeFields(t reflect.Type) *structFields {
+	fields := cachedTypeFields(t)
+	if o.naming == nil {
+		return fields
+	}
+	builtin := builtinNaming(o.naming)
+	key := namedFieldsKey{t: t, naming: builtin}
+	if builtin >= 0 {
+		if f, ok := namedFieldCache.Load(key); ok {
+			return f.(*structFields)
+		}
+	} else if f, ok := o.namedFields[t]; ok {
+		return f
+	}
+	named := &structFields{list: make([]field, len(fields.list)), byName: make(map[string]int), err: fields.err}
+	copy(named.list, fields.list)
+	for i := range named.list {
+		f := &named.list[i]
+		if !f.tagged {
+			f.name = o.naming(f.name)
+			f.nameJSON = leptStringifyString(f.name) + ":"
+		}
+		if _, ok := named.byName[f.name]; !ok {
+			named.byName[f.name] = i
+		}
+	}
+	if builtin < 0 {
+		if o.namedFields == nil {
+			o.namedFields = make(map[reflect.Type]*structFields)
+		}
+		o.namedFields[t] = named
+		return named
+	}
+	f, _ := namedFieldCache.LoadOrStore(key, named)
+	return f.(*structFields)
+}
+
+func (d *decodeState) toStruct(v *LeptValue, rv reflect.Value) error {
 	if !rv.IsValid() {
 		return fmt.Errorf("v is not valid")
 	}
 	decodingNull := v != nil && v.typ == LeptNull
-	u, pv := indirect(rv, decodingNull)
+	u, ut, pv := indirect(rv, decodingNull)
 	if u != nil {
 		err := u.UnmarshalJSON(v, pv)
 		return err
 	}
+	if ut != nil {
+		return leptUnmarshalText(v, ut)
+	}
 	rv = pv
-	size := rv.NumField()
-	rt := rv.Type()
-	// 这里没有考虑到 嵌套匿名字段 的处理
-	for i := 0; i < size; i++ {
-		fit := rt.Field(i)
-		// fmt.Println(fit.Tag)
-		tag := fit.Tag.Get("json")
-		if tag == "-" {
-			continue
+	if v == nil {
+		return d.structDefaults(rv)
+	}
+	if v.typ != LeptObject {
+		return fmt.Errorf("v LeptValue is not a object: %v", v.typ)
+	}
+	fields := d.opts.typeFields(rv.Type())
+	if fields.err != nil {
+		return fields.err
+	}
+	if d.opts.disallowUnknownFields {
+		for _, m := range v.o {
+			if _, ok := fields.byName[m.key]; !ok {
+				return fmt.Errorf("unknown field %q", m.key)
+			}
 		}
-		name, opts := parseTag(tag)
-		fiName := name
-		// 只有 encode 的时候， omitempty 是起作用的
-		if strings.Index(opts, "omitempty") != -1 {
-			fmt.Println(tag, opts)
-		}
-		// fmt.Println()
-		// fmt.Println(fit.Tag.Get("omitempty"))
-		// fiName := fit.Name
-		if v == nil {
-			// if err := toValue(v, rv.Field(i)); err != nil {
-			// 	return err
-			// }
-		} else if v.typ != LeptObject {
-			return fmt.Errorf("v LeptValue is not a object: %v", v.typ)
-		} else {
-			liv := LeptFindObjectValue(v, fiName)
-			if err := toValue(liv, rv.Field(i)); err != nil {
+	}
+	for i := range fields.list {
+		f := &fields.list[i]
+		liv := LeptFindObjectValue(v, f.name)
+		if liv == nil || liv.typ == LeptNull && d.opts.defaultOnNull && f.defaultValue != nil {
+			liv = f.newDefault()
+		}
+		if err := d.toValue(liv, rv.Field(f.index), f.opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// structDefaults 在 struct 对应的 key 不存在时调用，只设置有 default tag 的字段，
+// 嵌套的 struct 同样处理，其余的字段保持不变
+func (d *decodeState) structDefaults(rv reflect.Value) error {
+	fields := d.opts.typeFields(rv.Type())
+	if fields.err != nil {
+		return fields.err
+	}
+	for i := range fields.list {
+		f := &fields.list[i]
+		fv := rv.Field(f.index)
+		if f.defaultValue != nil {
+			if err := d.toValue(f.newDefault(), fv, f.opts); err != nil {
+				return err
+			}
+		} else if fv.Kind() == reflect.Struct {
+			if err := d.toValue(nil, fv, f.opts); err != nil {
 				return err
 			}
 		}
 	}
 	return nil
 }
-func toMap(v *LeptValue, rv reflect.Value) error {
+func (d *decodeState) toMap(v *LeptValue, rv reflect.Value) error {
 	if !rv.IsValid() {
 		return fmt.Errorf("v is not valid")
 	}
 	decodingNull := v != nil && v.typ == LeptNull
-	u, pv := indirect(rv, decodingNull)
+	u, ut, pv := indirect(rv, decodingNull)
 	if u != nil {
 		err := u.UnmarshalJSON(v, pv)
 		return err
 	}
+	if ut != nil {
+		return leptUnmarshalText(v, ut)
+	}
 	rv = pv
 	vsize := 0
 	if v == nil {
@@ -1651,6 +2740,9 @@ func toMap(v *LeptValue, rv reflect.Value) error {
 	} else {
 		vsize = LeptGetObjectSize(v)
 	}
+	if !isValidMapKeyType(rv.Type().Key(), textUnmarshalerType) {
+		return fmt.Errorf("map key type is unsupported: %v", rv.Type().Key())
+	}
 	// fix panic: assignment to entry in nil map [recovered]
 	if rv.IsNil() {
 		rv.Set(reflect.MakeMap(rv.Type()))
@@ -1676,7 +2768,10 @@ func toMap(v *LeptValue, rv reflect.Value) error {
 		// rikt := rv.Type().Key()
 		// rikv := reflect.New(rikt).Elem()
 		// rikv.Set(reflect.ValueOf(lik))
-		rikv := reflect.ValueOf(lik)
+		rikv, err := leptMapKey(rv.Type().Key(), lik)
+		if err != nil {
+			return err
+		}
 		// 这里的 key 应该是 []byte
 		// value of type []uint8 cannot be converted to type int
 		// rikv := reflect.ValueOf([]byte(lik)).Convert(rv.Type().Key())
@@ -1695,23 +2790,66 @@ func toMap(v *LeptValue, rv reflect.Value) error {
 		var rivv reflect.Value
 		// rivv.Set(reflect.Zero(rivt))
 		rivv = reflect.New(rivt).Elem()
-		if err := toValue(liv, rivv); err != nil {
+		if err := d.toValue(liv, rivv, fieldOptions{}); err != nil {
 			return err
 		}
 		rv.SetMapIndex(rikv, rivv)
 	}
 	return nil
 }
-func toSlice(v *LeptValue, rv reflect.Value) error {
+
+// leptMapKey 将 object 的 key 转换为 map 的 key 类型
+// 和 encoding/json 一样，encoding.TextUnmarshaler 优先于 string
+func leptMapKey(kt reflect.Type, key string) (reflect.Value, error) {
+	if reflect.PtrTo(kt).Implements(textUnmarshalerType) {
+		kv := reflect.New(kt)
+		if err := kv.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(key)); err != nil {
+			return reflect.Value{}, err
+		}
+		return kv.Elem(), nil
+	}
+	switch kt.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(key).Convert(kt), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(key, 10, 64)
+		if err != nil || reflect.Zero(kt).OverflowInt(n) {
+			return reflect.Value{}, fmt.Errorf("object key %q is not a valid %v", key, kt)
+		}
+		return reflect.ValueOf(n).Convert(kt), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(key, 10, 64)
+		if err != nil || reflect.Zero(kt).OverflowUint(n) {
+			return reflect.Value{}, fmt.Errorf("object key %q is not a valid %v", key, kt)
+		}
+		return reflect.ValueOf(n).Convert(kt), nil
+	}
+	return reflect.Value{}, fmt.Errorf("map key type is unsupported: %v", kt)
+}
+
+// isValidMapKeyType map 的 key 只支持 string, int, uint 以及实现了 Text(Un)Marshaler 的类型
+func isValidMapKeyType(kt reflect.Type, textType reflect.Type) bool {
+	switch kt.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return kt.Implements(textType) || reflect.PtrTo(kt).Implements(textType)
+}
+func (d *decodeState) toSlice(v *LeptValue, rv reflect.Value) error {
 	if !rv.IsValid() {
 		return fmt.Errorf("v is not valid")
 	}
 	decodingNull := v != nil && v.typ == LeptNull
-	u, pv := indirect(rv, decodingNull)
+	u, ut, pv := indirect(rv, decodingNull)
 	if u != nil {
 		err := u.UnmarshalJSON(v, pv)
 		return err
 	}
+	if ut != nil {
+		return leptUnmarshalText(v, ut)
+	}
 	rv = pv
 	size := rv.Len()
 	vsize := 0
@@ -1751,214 +2889,1078 @@ func toSlice(v *LeptValue, rv reflect.Value) error {
 			if i < vsize {
 				liv = LeptGetArrayElement(v, i)
 			}
-			if err := toValue(liv, rv.Index(i)); err != nil {
+			if err := d.toValue(liv, rv.Index(i), fieldOptions{}); err != nil {
 				return err
 			}
 		}
 	}
 	return nil
 }
+
+// toQuotedValue 处理 json:",string" 的字段，v 应该是一个 json 字符串，
+// 其中的内容再作为 bool number string 解析。null 不会修改 rv。
+// 整数直接使用 strconv 解析，避免经过 float64 丢失 int64 的精度
+func (d *decodeState) toQuotedValue(v *LeptValue, rv reflect.Value) error {
+	if v.typ == LeptNull {
+		return nil
+	}
+	if v.typ != LeptString {
+		return fmt.Errorf("v LeptValue is not a quoted string: %v", v.typ)
+	}
+	inner := NewLeptValue()
+	if event := LeptParse(inner, v.s); event != LeptParseOK {
+		return fmt.Errorf("v LeptValue quoted string %q parse error: %v", v.s, event)
+	}
+	if strings.TrimSpace(v.s) != v.s {
+		return fmt.Errorf("v LeptValue quoted string %q has extra whitespace", v.s)
+	}
+	if inner.typ == LeptNull {
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		if inner.typ != LeptString {
+			return fmt.Errorf("v LeptValue quoted string %q is not a string: %v", v.s, inner.typ)
+		}
+	case reflect.Bool:
+		if inner.typ != LeptTrue && inner.typ != LeptFalse {
+			return fmt.Errorf("v LeptValue quoted string %q is not a bool: %v", v.s, inner.typ)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if inner.typ != LeptNumber {
+			return fmt.Errorf("v LeptValue quoted string %q is not a number: %v", v.s, inner.typ)
+		}
+		n, err := strconv.ParseInt(v.s, 10, 64)
+		if err == nil && !rv.OverflowInt(n) {
+			rv.SetInt(n)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if inner.typ != LeptNumber {
+			return fmt.Errorf("v LeptValue quoted string %q is not a number: %v", v.s, inner.typ)
+		}
+		n, err := strconv.ParseUint(v.s, 10, 64)
+		if err == nil && !rv.OverflowUint(n) {
+			rv.SetUint(n)
+			return nil
+		}
+	default:
+		if inner.typ != LeptNumber {
+			return fmt.Errorf("v LeptValue quoted string %q is not a number: %v", v.s, inner.typ)
+		}
+	}
+	// 1e3 1.5 这样的写法，以及溢出的情况，交给 toValue 检查并给出错误
+	return d.toValue(inner, rv, fieldOptions{})
+}
+
+// toBytes 将 base64 字符串解码为 []byte，同时接受有 padding 和没有 padding 的格式
+func toBytes(v *LeptValue, rv reflect.Value) error {
+	b, err := base64.StdEncoding.DecodeString(v.s)
+	if err != nil {
+		b, err = base64.RawStdEncoding.DecodeString(v.s)
+	}
+	if err != nil {
+		return fmt.Errorf("v LeptValue is not a base64 string: %v", err)
+	}
+	rv.SetBytes(b)
+	return nil
+}
 func setValue(rv reflect.Value) {
 	rv.SetBool(true)
 }
 
 // Unmarshal parse input data into structure
-func Unmarshal(data []byte, structure interface{}) error {
-	v := NewLeptValue()
-	event := LeptParse(v, string(data))
+// 和 LeptParse + ToStruct 的结果一致，但是不会先生成完整的 LeptValue 树，
+// object array 直接驱动反射，未知的 key 只做语法检查
+func Unmarshal(data []byte, structure interface{}, opts ...Option) error {
+	return unmarshal(data, structure, newOptions(opts))
+}
+
+// unmarshal 使用 o 解析 data，Decoder 在多次 Decode 之间共享 o
+func unmarshal(data []byte, structure interface{}, o *options) error {
+	d := &decodeState{c: NewLeptContext(string(data)), opts: o}
+	d.c.utf8 = d.opts.utf8
+	d.c.numberText = d.opts.useNumber
+	rv := reflect.ValueOf(structure)
+	if !rv.IsValid() {
+		d.saveError(fmt.Errorf("structure value is not valid"))
+	} else if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		d.saveError(fmt.Errorf("structure is not a ptr: %v", reflect.TypeOf(structure)))
+	}
+	LeptParseWhitespace(d.c)
+	event := d.value(rv, fieldOptions{})
+	if event == LeptParseOK {
+		LeptParseWhitespace(d.c)
+		if len(d.c.json) != 0 {
+			event = LeptParseRootNotSingular
+		}
+	}
+	// 语法错误优先于类型错误，和先 LeptParse 再 ToStruct 的顺序保持一致
 	if event != LeptParseOK {
 		return fmt.Errorf("Unmarshal parse error: %v", event)
 	}
-	return ToStruct(v, structure)
-}
-
-// Marshaler is the interface implemented by objects that
-// can marshal themselves into valid JSON.
-type Marshaler interface {
-	MarshalJSON() ([]byte, error)
+	if d.savedError == nil && d.opts.validate {
+		return validateValue(rv, d.opts)
+	}
+	return d.savedError
 }
 
-var (
-	marshalerType = reflect.TypeOf(new(Marshaler)).Elem()
-)
-
-type encodeState struct {
-	bytes.Buffer
+// decodeState 是 Unmarshal 的单遍解析状态
+// 遇到第一个类型错误之后，剩下的输入只做语法检查，不再修改 rv
+type decodeState struct {
+	c          *LeptContext
+	opts       *options
+	savedError error
 }
 
-// Marshal stringify the input structure
-func Marshal(structure interface{}) ([]byte, error) {
-	e := &encodeState{}
-	err := e.marshal(structure)
-	if err != nil {
-		return nil, err
+func (d *decodeState) saveError(err error) {
+	if d.savedError == nil {
+		d.savedError = err
 	}
-	return e.Bytes(), nil
 }
 
-func (e *encodeState) marshal(structure interface{}) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			if _, ok := r.(runtime.Error); ok {
-				panic(r)
+// value 解析一个 json 值到 rv 中
+// object array 对应 struct map slice array 时直接解析，其余情况解析出 LeptValue 交给 toValue
+func (d *decodeState) value(rv reflect.Value, opts fieldOptions) LeptEvent {
+	if d.savedError != nil {
+		return leptSkipValue(d.c)
+	}
+	if len(d.c.json) == 0 {
+		return LeptParseExpectValue
+	}
+	// RawMessage 直接取输入中的原始文本，不需要生成 LeptValue
+	if isRawMessageType(rv.Type()) {
+		if _, _, pv := indirect(rv, d.c.json[0] == 'n'); pv.Type() == rawMessageType {
+			start := d.c.json
+			if event := leptSkipValue(d.c); event != LeptParseOK {
+				return event
 			}
-			if s, ok := r.(string); ok {
-				panic(s)
+			pv.SetBytes(append(pv.Bytes()[0:0], start[:len(start)-len(d.c.json)]...))
+			return LeptParseOK
+		}
+	}
+	switch d.c.json[0] {
+	case '{':
+		u, ut, pv := indirect(rv, false)
+		if u == nil && ut == nil {
+			switch pv.Kind() {
+			case reflect.Struct:
+				if pv.Type() == leptValueType {
+					break
+				}
+				fields := d.opts.typeFields(pv.Type())
+				// 有重复的 name 时，多个字段共享同一个值，交给 toStruct 处理
+				if len(fields.byName) == len(fields.list) {
+					return d.object(pv, fields)
+				}
+			case reflect.Map:
+				return d.objectMap(pv)
 			}
-			err = r.(error)
 		}
-	}()
-	e.reflectValue(reflect.ValueOf(structure), true)
-	return nil
+	case '[':
+		u, ut, pv := indirect(rv, false)
+		if u == nil && ut == nil && (pv.Kind() == reflect.Slice || pv.Kind() == reflect.Array) {
+			return d.array(pv)
+		}
+	}
+	return d.literal(rv, opts)
 }
-func isEmptyValue(v reflect.Value) bool {
-	switch v.Kind() {
-	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
-		return v.Len() == 0
-	case reflect.Bool:
-		return !v.Bool()
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return v.Int() == 0
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		return v.Uint() == 0
-	case reflect.Float32, reflect.Float64:
-		return v.Float() == 0
-	case reflect.Interface, reflect.Ptr:
-		return v.IsNil()
+
+// isRawMessageType 判断 t 是否是 RawMessage 或者指向 RawMessage 的指针
+func isRawMessageType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
 	}
-	return false
+	return t == rawMessageType
 }
-func (e *encodeState) reflectValue(v reflect.Value, allowAddr bool) {
-	if !v.IsValid() {
-		e.WriteString("null")
-		return
+
+// literal 将当前的值解析为 LeptValue，再交给 toValue
+func (d *decodeState) literal(rv reflect.Value, opts fieldOptions) LeptEvent {
+	v := NewLeptValue()
+	if event := LeptParseValue(d.c, v); event != LeptParseOK {
+		return event
 	}
-	t := v.Type()
-	if t.Implements(marshalerType) {
-		marshalerEncoder(e, v, false)
-		return
+	if v.typ == LeptNumber && v.s == "" {
+		// 数字的原始文本直接取输入的子串，不需要分配，保存到 Go 值中的地方负责复制
+		start, end := d.c.Span()
+		v.s = d.c.src[start:end]
 	}
-	if t.Kind() != reflect.Ptr && allowAddr {
-		if reflect.PtrTo(t).Implements(marshalerType) {
-			if v.CanAddr() {
-				addrMarshalerEncoder(e, v, false)
+	d.saveError(d.toValue(v, rv, opts))
+	return LeptParseOK
+}
+
+// object 解析 object 到 struct 中，对应 toStruct
+// 重复的 key 以第一个为准，没有出现的字段设置为零值
+func (d *decodeState) object(rv reflect.Value, fields *structFields) LeptEvent {
+	c := d.c
+	seen := make([]bool, len(fields.list))
+	d.saveError(fields.err)
+	expect(c, '{')
+	LeptParseWhitespace(c)
+	if len(c.json) == 0 {
+		return LeptParseMissCommaOrCurlyBracket
+	}
+	if c.json[0] == '}' {
+		c.json = c.json[1:]
+		d.objectEnd(rv, fields, seen)
+		return LeptParseOK
+	}
+	for {
+		key, event := leptParseMemberKey(c)
+		if event != LeptParseOK {
+			return event
+		}
+		i, ok := fields.byName[key]
+		if !ok && d.opts.disallowUnknownFields {
+			d.saveError(fmt.Errorf("unknown field %q", key))
+		}
+		if ok && !seen[i] {
+			seen[i] = true
+			f := &fields.list[i]
+			if f.defaultValue != nil && d.opts.defaultOnNull && strings.HasPrefix(c.json, "null") {
+				// 和 key 不存在一样，交给 objectEnd 使用 default 的值
+				seen[i] = false
+				event = leptSkipValue(c)
 			} else {
-				e.reflectValue(v, false)
+				event = d.value(rv.Field(f.index), f.opts)
 			}
+		} else {
+			event = leptSkipValue(c)
+		}
+		if event != LeptParseOK {
+			return event
+		}
+		end, event := leptParseMemberEnd(c, '}', LeptParseMissCommaOrCurlyBracket)
+		if event != LeptParseOK {
+			return event
+		}
+		if end {
+			d.objectEnd(rv, fields, seen)
+			return LeptParseOK
+		}
+	}
+}
+
+// objectEnd 将没有出现在 object 中的字段设置为零值
+func (d *decodeState) objectEnd(rv reflect.Value, fields *structFields, seen []bool) {
+	for i := range fields.list {
+		if d.savedError != nil {
 			return
 		}
+		if !seen[i] {
+			f := &fields.list[i]
+			d.saveError(d.toValue(f.newDefault(), rv.Field(f.index), f.opts))
+		}
 	}
+}
 
-	switch t.Kind() {
-	case reflect.Bool:
-		if v.Bool() {
-			e.WriteString("true")
+// objectMap 解析 object 到 map 中，对应 toMap
+func (d *decodeState) objectMap(rv reflect.Value) LeptEvent {
+	c := d.c
+	kt := rv.Type().Key()
+	if !isValidMapKeyType(kt, textUnmarshalerType) {
+		d.saveError(fmt.Errorf("map key type is unsupported: %v", kt))
+		return leptSkipValue(c)
+	}
+	if rv.IsNil() {
+		rv.Set(reflect.MakeMap(rv.Type()))
+	}
+	expect(c, '{')
+	LeptParseWhitespace(c)
+	if len(c.json) == 0 {
+		return LeptParseMissCommaOrCurlyBracket
+	}
+	if c.json[0] == '}' {
+		c.json = c.json[1:]
+		return LeptParseOK
+	}
+	for {
+		key, event := leptParseMemberKey(c)
+		if event != LeptParseOK {
+			return event
+		}
+		var kv reflect.Value
+		if d.savedError == nil {
+			if kt.Kind() == reflect.String {
+				key = leptCloneString(key)
+			}
+			var err error
+			kv, err = leptMapKey(kt, key)
+			d.saveError(err)
+		}
+		if d.savedError != nil {
+			event = leptSkipValue(c)
 		} else {
-			e.WriteString("false")
+			ev := reflect.New(rv.Type().Elem()).Elem()
+			event = d.value(ev, fieldOptions{})
+			if event == LeptParseOK && d.savedError == nil {
+				rv.SetMapIndex(kv, ev)
+			}
+		}
+		if event != LeptParseOK {
+			return event
+		}
+		end, event := leptParseMemberEnd(c, '}', LeptParseMissCommaOrCurlyBracket)
+		if event != LeptParseOK {
+			return event
+		}
+		if end {
+			return LeptParseOK
+		}
+	}
+}
+
+// array 解析 array 到 slice 或者 array 中，对应 toSlice
+// slice 按需扩容，rv 中多出来的元素设置为零值，array 放不下的元素直接跳过
+func (d *decodeState) array(rv reflect.Value) LeptEvent {
+	c := d.c
+	expect(c, '[')
+	LeptParseWhitespace(c)
+	if len(c.json) == 0 {
+		return LeptParseMissCommaOrSouareBracket
+	}
+	i := 0
+	if c.json[0] == ']' {
+		c.json = c.json[1:]
+		d.arrayEnd(rv, i)
+		return LeptParseOK
+	}
+	for {
+		if rv.Kind() == reflect.Slice && d.savedError == nil {
+			if i >= rv.Cap() {
+				newcap := rv.Cap() + rv.Cap()/2
+				if newcap < 4 {
+					newcap = 4
+				}
+				newv := reflect.MakeSlice(rv.Type(), rv.Len(), newcap)
+				reflect.Copy(newv, rv)
+				rv.Set(newv)
+			}
+			if i >= rv.Len() {
+				rv.SetLen(i + 1)
+			}
+		}
+		var event LeptEvent
+		if i < rv.Len() {
+			event = d.value(rv.Index(i), fieldOptions{})
+		} else {
+			event = leptSkipValue(c)
+		}
+		if event != LeptParseOK {
+			return event
+		}
+		i++
+		end, event := leptParseMemberEnd(c, ']', LeptParseMissCommaOrSouareBracket)
+		if event != LeptParseOK {
+			return event
+		}
+		if end {
+			d.arrayEnd(rv, i)
+			return LeptParseOK
+		}
+	}
+}
+
+// arrayEnd 将下标 n 之后原有的元素设置为零值
+func (d *decodeState) arrayEnd(rv reflect.Value, n int) {
+	for i := n; i < rv.Len(); i++ {
+		if d.savedError != nil {
+			return
+		}
+		d.saveError(d.toValue(nil, rv.Index(i), fieldOptions{}))
+	}
+}
+
+// leptParseMemberKey 解析 object 中的 key 以及之后的冒号
+func leptParseMemberKey(c *LeptContext) (string, LeptEvent) {
+	if len(c.json) == 0 || c.json[0] != '"' {
+		return "", LeptParseMissKey
+	}
+	// key 只用于查找字段，不需要复制，保存到 map 中时由调用者复制
+	key, event := leptParseStringUTF8(c, true)
+	if event != LeptParseOK {
+		return "", event
+	}
+	LeptParseWhitespace(c)
+	if len(c.json) == 0 || c.json[0] != ':' {
+		return "", LeptParseMissColon
+	}
+	c.json = c.json[1:]
+	LeptParseWhitespace(c)
+	return key, LeptParseOK
+}
+
+// leptParseMemberEnd 解析一个元素之后的逗号或者结束符号 closing，end 表示遇到了结束符号
+func leptParseMemberEnd(c *LeptContext, closing byte, miss LeptEvent) (bool, LeptEvent) {
+	LeptParseWhitespace(c)
+	if len(c.json) == 0 {
+		return false, miss
+	}
+	switch c.json[0] {
+	case ',':
+		c.json = c.json[1:]
+		LeptParseWhitespace(c)
+		return false, LeptParseOK
+	case closing:
+		c.json = c.json[1:]
+		return true, LeptParseOK
+	}
+	return false, miss
+}
+
+// leptSkipValue 跳过一个 json 值，只做语法检查，返回的事件和 LeptParseValue 一致
+func leptSkipValue(c *LeptContext) LeptEvent {
+	if len(c.json) == 0 {
+		return LeptParseExpectValue
+	}
+	switch c.json[0] {
+	case '[', '{':
+		closing, miss := byte(']'), LeptParseMissCommaOrSouareBracket
+		if c.json[0] == '{' {
+			closing, miss = '}', LeptParseMissCommaOrCurlyBracket
+		}
+		c.json = c.json[1:]
+		LeptParseWhitespace(c)
+		if len(c.json) == 0 {
+			return miss
+		}
+		if c.json[0] == closing {
+			c.json = c.json[1:]
+			return LeptParseOK
 		}
+		for {
+			if closing == '}' {
+				if _, event := leptParseMemberKey(c); event != LeptParseOK {
+					return event
+				}
+			}
+			if event := leptSkipValue(c); event != LeptParseOK {
+				return event
+			}
+			end, event := leptParseMemberEnd(c, closing, miss)
+			if event != LeptParseOK {
+				return event
+			}
+			if end {
+				return LeptParseOK
+			}
+		}
+	}
+	var v LeptValue
+	return LeptParseValue(c, &v)
+}
+
+// isZeroer 是 omitzero 使用的 IsZero 方法，例如 time.Time
+type isZeroer interface {
+	IsZero() bool
+}
+
+// Marshaler is the interface implemented by objects that
+// can marshal themselves into valid JSON.
+type Marshaler interface {
+	MarshalJSON() ([]byte, error)
+}
+
+var (
+	marshalerType       = reflect.TypeOf(new(Marshaler)).Elem()
+	textMarshalerType   = reflect.TypeOf(new(encoding.TextMarshaler)).Elem()
+	textUnmarshalerType = reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem()
+	unmarshalerType     = reflect.TypeOf(new(Unmarshaler)).Elem()
+	leptValueType       = reflect.TypeOf(LeptValue{})
+	rawMessageType      = reflect.TypeOf(RawMessage(nil))
+	numberType          = reflect.TypeOf(Number(""))
+	isZeroerType        = reflect.TypeOf(new(isZeroer)).Elem()
+)
+
+type encodeState struct {
+	bytes.Buffer
+	opts    *options
+	scratch [64]byte
+
+	// 嵌套超过 startDetectingCyclesAfter 层之后，ptrSeen 记录当前路径上的指针 map slice，
+	// 再次遇到时说明有环，避免无限递归导致栈溢出
+	ptrLevel uint
+	ptrSeen  map[cycleKey]struct{}
+
+	// b 不为 nil 时 (FromInterface) 写入函数构造 LeptValue，而不是写入 json 文本，
+	// 编码器只调用 writeNull writeString objectStart 等写入函数，两种输出使用同一套规则
+	b *leptBuilder
+}
+
+// leptBuilder 是 FromInterface 构造 LeptValue 的状态
+type leptBuilder struct {
+	root  *LeptValue
+	stack []*LeptValue // 还没有结束的 array object
+	key   string       // 当前 object 中下一个值的 key
+}
+
+// next 返回下一个值的位置，添加到当前的 array object 中，没有时是 root
+func (b *leptBuilder) next() *LeptValue {
+	if len(b.stack) == 0 {
+		b.root = NewLeptValue()
+		return b.root
+	}
+	top := b.stack[len(b.stack)-1]
+	if top.typ == LeptArray {
+		return LeptPushBackArrayElement(top)
+	}
+	// struct 的字段不会重复，map 的 key 重复时和解析的结果一样保留多个，所以直接添加
+	m := &LeptMember{key: b.key, value: NewLeptValue()}
+	top.o = append(top.o, m)
+	return m.value
+}
+
+// raw 将合法的 json 文本 s 解析为下一个值，数字保留原始文本
+func (b *leptBuilder) raw(s string) {
+	c := NewLeptContext(s)
+	c.numberText = true
+	LeptParseWhitespace(c)
+	LeptParseValue(c, b.next())
+}
+
+const startDetectingCyclesAfter = 1000
+
+// cycleKey 标识一个指针 map 或者 slice
+// struct 和它的第一个字段地址相同，所以包含类型；同一个底层数组的不同切片不一定有环，所以包含长度
+type cycleKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// enterCycleCheck 进入指针 map slice 之前调用，返回值需要传给 leaveCycleCheck
+// 只有 ptrLevel 超过阈值时才记录 key，常见的浅层数据不需要额外的开销
+func (e *encodeState) enterCycleCheck(v reflect.Value) *cycleKey {
+	if e.ptrLevel++; e.ptrLevel <= startDetectingCyclesAfter {
+		return nil
+	}
+	key := cycleKey{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		key.len = v.Len()
+	}
+	if _, ok := e.ptrSeen[key]; ok {
+		panic(&UnsupportedValueError{Value: v, Str: fmt.Sprintf("encountered a cycle via %s", v.Type())})
+	}
+	if e.ptrSeen == nil {
+		e.ptrSeen = make(map[cycleKey]struct{})
+	}
+	e.ptrSeen[key] = struct{}{}
+	return &key
+}
+
+func (e *encodeState) leaveCycleCheck(key *cycleKey) {
+	if key != nil {
+		delete(e.ptrSeen, *key)
+	}
+	e.ptrLevel--
+}
+
+// encoderFunc 是某个类型的编码函数，由 typeEncoder 按类型缓存
+type encoderFunc func(e *encodeState, v reflect.Value, opts fieldOptions)
+
+var encoderCache sync.Map // map[reflect.Type]encoderFunc
+
+// Marshal stringify the input structure
+// 可以使用 EscapeHTML EscapeASCII 设置字符串的转义方式，默认不转义 HTML 字符，和 Encoder 的默认值不同
+func Marshal(structure interface{}, opts ...Option) ([]byte, error) {
+	e := &encodeState{opts: newOptions(opts)}
+	err := e.marshal(structure)
+	if err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+func (e *encodeState) marshal(structure interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(runtime.Error); ok {
+				panic(r)
+			}
+			if s, ok := r.(string); ok {
+				panic(s)
+			}
+			err = r.(error)
+		}
+	}()
+	e.reflectValue(reflect.ValueOf(structure), fieldOptions{})
+	return nil
+}
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		b := strconv.AppendInt([]byte(""), v.Int(), 10)
-		e.Write(b)
+		return v.Int() == 0
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		b := strconv.AppendUint([]byte(""), v.Uint(), 10)
-		e.Write(b)
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+func (e *encodeState) reflectValue(v reflect.Value, opts fieldOptions) {
+	valueEncoder(v)(e, v, opts)
+}
+
+func valueEncoder(v reflect.Value) encoderFunc {
+	if !v.IsValid() {
+		return invalidValueEncoder
+	}
+	return typeEncoder(v.Type())
+}
+
+// typeEncoder 返回 t 的编码函数，每个类型只会构造一次
+func typeEncoder(t reflect.Type) encoderFunc {
+	if fi, ok := encoderCache.Load(t); ok {
+		return fi.(encoderFunc)
+	}
+	// 递归类型如 type T struct{ Next *T } 构造编码函数时会再次进入 typeEncoder(T)，
+	// 所以先存入一个间接的函数，等待真正的 f 构造完成
+	var (
+		wg sync.WaitGroup
+		f  encoderFunc
+	)
+	wg.Add(1)
+	fi, loaded := encoderCache.LoadOrStore(t, encoderFunc(func(e *encodeState, v reflect.Value, opts fieldOptions) {
+		wg.Wait()
+		f(e, v, opts)
+	}))
+	if loaded {
+		return fi.(encoderFunc)
+	}
+	f = newTypeEncoder(t, true)
+	wg.Done()
+	encoderCache.Store(t, f)
+	return f
+}
+
+// newTypeEncoder 依次检查 Marshaler, encoding.TextMarshaler 和 Kind。
+// allowAddr 为 true 时，可以取地址的值也会使用指针接收者实现的方法
+func newTypeEncoder(t reflect.Type, allowAddr bool) encoderFunc {
+	// 不能取地址的 LeptValue 无法调用 MarshalJSON，这里直接处理
+	if t == leptValueType {
+		return leptValueEncoder
+	}
+	// *LeptValue 同样直接处理，使用 Marshal 的 opts，而不是 MarshalJSON 的默认设置
+	if t == reflect.PtrTo(leptValueType) {
+		return leptValuePtrEncoder
+	}
+	if t == numberType {
+		return numberEncoder
+	}
+	if t.Kind() != reflect.Ptr && allowAddr && reflect.PtrTo(t).Implements(marshalerType) {
+		return newCondAddrEncoder(addrMarshalerEncoder, newTypeEncoder(t, false))
+	}
+	if t.Implements(marshalerType) {
+		return marshalerEncoder
+	}
+	if t.Kind() != reflect.Ptr && allowAddr && reflect.PtrTo(t).Implements(textMarshalerType) {
+		return newCondAddrEncoder(addrTextMarshalerEncoder, newTypeEncoder(t, false))
+	}
+	if t.Implements(textMarshalerType) {
+		return textMarshalerEncoder
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return boolEncoder
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return intEncoder
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return uintEncoder
 	case reflect.Float32:
-		b := strconv.AppendFloat([]byte(""), v.Float(), 'g', -1, 32)
-		e.Write(b)
+		return float32Encoder
 	case reflect.Float64:
-		b := strconv.AppendFloat([]byte(""), v.Float(), 'g', -1, 64)
-		e.Write(b)
+		return float64Encoder
 	case reflect.String:
-		e.WriteString(leptStringifyString(v.String()))
+		return stringEncoder
 	case reflect.Interface:
-		if v.IsNil() {
-			e.WriteString("null")
-			return
-		}
-		e.reflectValue(v.Elem(), false)
+		return interfaceEncoder
 	case reflect.Struct:
-		e.WriteByte('{')
-		first := true
-		size := v.NumField()
-		rt := t
-		for i := 0; i < size; i++ {
-			fit := rt.Field(i)
-			// fmt.Println(fit.Tag)
-			if fit.PkgPath != "" {
-				// unexported
-				continue
-			}
-			tag := fit.Tag.Get("json")
-			if tag == "-" {
-				continue
-			}
-			name, opts := parseTag(tag)
-			// 只有 encode 的时候， omitempty 是起作用的
-			fi := v.Field(i)
-			if !fi.IsValid() || strings.Index(opts, "omitempty") != -1 && isEmptyValue(fi) {
+		return newStructEncoder(t)
+	case reflect.Map:
+		return newMapEncoder(t)
+	case reflect.Slice:
+		return newSliceEncoder(t)
+	case reflect.Array:
+		return newArrayEncoder(t)
+	case reflect.Ptr:
+		return newPtrEncoder(t)
+	default:
+		return unsupportedTypeEncoder
+	}
+}
+
+func leptValueEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	lv := v.Interface().(LeptValue)
+	e.writeLeptValue(&lv)
+}
+
+// leptValuePtrEncoder 使用 e.opts 输出 *LeptValue，nil 输出 null
+func leptValuePtrEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	if v.IsNil() {
+		e.writeNull()
+		return
+	}
+	e.writeLeptValue(v.Interface().(*LeptValue))
+}
+
+// numberEncoder 原样输出 Number，空字符串输出 0
+func numberEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	s := v.String()
+	if s == "" {
+		s = "0"
+	}
+	if !isValidNumber(s) {
+		panic(fmt.Errorf("invalid number literal %q", s))
+	}
+	e.writeQuoted([]byte(s), opts.quoted)
+}
+
+func invalidValueEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	e.writeNull()
+}
+
+func unsupportedTypeEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	panic(&UnsupportedTypeError{Type: v.Type()})
+}
+
+func boolEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	e.writeBool(v.Bool(), opts.quoted)
+}
+
+func intEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	b := strconv.AppendInt(e.scratch[:0], v.Int(), 10)
+	e.writeQuoted(b, opts.quoted)
+}
+
+func uintEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	b := strconv.AppendUint(e.scratch[:0], v.Uint(), 10)
+	e.writeQuoted(b, opts.quoted)
+}
+
+// NaN 以及 ±Infinity 按照 e.opts.nonFinite 处理，忽略 ,string 选项
+func float32Encoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	if f := v.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+		e.writeNonFinite(f, v)
+		return
+	}
+	b := strconv.AppendFloat(e.scratch[:0], v.Float(), 'g', -1, 32)
+	e.writeQuoted(b, opts.quoted)
+}
+
+func float64Encoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	if f := v.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+		e.writeNonFinite(f, v)
+		return
+	}
+	b := strconv.AppendFloat(e.scratch[:0], v.Float(), 'g', -1, 64)
+	e.writeQuoted(b, opts.quoted)
+}
+
+func stringEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	if opts.quoted {
+		// 和 encoding/json 一样，内层的字符串同样按照 e.opts 转义
+		var inner bytes.Buffer
+		if err := leptWriteString(&inner, v.String(), e.opts); err != nil {
+			panic(err)
+		}
+		e.writeString(inner.String())
+	} else {
+		e.writeString(v.String())
+	}
+}
+
+func interfaceEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	if v.IsNil() {
+		e.writeNull()
+		return
+	}
+	e.reflectValue(v.Elem(), opts)
+}
+
+func newStructEncoder(t reflect.Type) encoderFunc {
+	fields := cachedTypeFields(t)
+	return func(e *encodeState, v reflect.Value, opts fieldOptions) {
+		fields := fields
+		if e.opts.naming != nil {
+			fields = e.opts.typeFields(t)
+		}
+		e.objectStart()
+		n := 0
+		for i := range fields.list {
+			f := &fields.list[i]
+			fv := v.Field(f.index)
+			// 只有 encode 的时候， omitempty omitzero 是起作用的
+			if f.omit(fv) {
 				continue
 			}
-			if first {
-				first = false
-			} else {
-				e.WriteByte(',')
-			}
-			e.WriteString(leptStringifyString(name))
-			e.WriteByte(':')
-			e.reflectValue(fi, true)
+			e.objectKey(n, f.name, f.nameJSON)
+			n++
+			f.encoder(e, fv, f.opts)
 		}
-		e.WriteByte('}')
-	case reflect.Map:
+		e.objectEnd()
+	}
+}
+
+func newMapEncoder(t reflect.Type) encoderFunc {
+	validKey := isValidMapKeyType(t.Key(), textMarshalerType)
+	elemEnc := typeEncoder(t.Elem())
+	return func(e *encodeState, v reflect.Value, opts fieldOptions) {
 		if v.IsNil() {
-			e.WriteString("null")
+			e.writeNull()
 			return
 		}
-		e.WriteByte('{')
-		sv := v.MapKeys()
-		sort.Slice(sv, func(i, j int) bool {
-			return sv[i].String() < sv[j].String()
-		})
-		for i, k := range sv {
-			if i > 0 {
-				e.WriteByte(',')
+		if !validKey {
+			panic(fmt.Errorf("map key type is unsupported: %v", t.Key()))
+		}
+		key := e.enterCycleCheck(v)
+		e.objectStart()
+		keys := v.MapKeys()
+		sv := make([]reflectWithString, len(keys))
+		for i, k := range keys {
+			sv[i].v = k
+			if err := sv[i].resolve(); err != nil {
+				panic(err)
 			}
-			e.WriteString(leptStringifyString(k.String()))
-			e.WriteByte(':')
-			// me.elemEnc(e, v.MapIndex(k), false)
-			e.reflectValue(v.MapIndex(k), false)
 		}
-		e.WriteByte('}')
-	case reflect.Slice:
+		if e.opts.sortKeys {
+			sort.Slice(sv, func(i, j int) bool {
+				return sv[i].s < sv[j].s
+			})
+		}
+		for i, kv := range sv {
+			e.objectKey(i, kv.s, "")
+			elemEnc(e, v.MapIndex(kv.v), fieldOptions{})
+		}
+		e.objectEnd()
+		e.leaveCycleCheck(key)
+	}
+}
+
+func newSliceEncoder(t reflect.Type) encoderFunc {
+	// 和 encoding/json 一样，元素类型自定义了编码方式的时候不使用 base64
+	p := reflect.PtrTo(t.Elem())
+	isBytes := t.Elem().Kind() == reflect.Uint8 &&
+		!p.Implements(marshalerType) && !p.Implements(textMarshalerType)
+	arrayEnc := newArrayEncoder(t)
+	return func(e *encodeState, v reflect.Value, opts fieldOptions) {
 		if v.IsNil() {
-			e.WriteString("null")
+			e.writeNull()
 			return
 		}
-		fallthrough
-	case reflect.Array:
-		e.WriteByte('[')
+		if isBytes && !opts.byteArray {
+			s := base64.StdEncoding.EncodeToString(v.Bytes())
+			if e.b != nil {
+				LeptSetString(e.b.next(), s)
+				return
+			}
+			// base64 的结果不需要转义
+			e.WriteByte('"')
+			e.WriteString(s)
+			e.WriteByte('"')
+			return
+		}
+		key := e.enterCycleCheck(v)
+		arrayEnc(e, v, opts)
+		e.leaveCycleCheck(key)
+	}
+}
+
+func newArrayEncoder(t reflect.Type) encoderFunc {
+	elemEnc := typeEncoder(t.Elem())
+	return func(e *encodeState, v reflect.Value, opts fieldOptions) {
+		e.arrayStart()
 		n := v.Len()
 		for i := 0; i < n; i++ {
-			if i > 0 {
-				e.WriteByte(',')
-			}
-			e.reflectValue(v.Index(i), false)
+			e.arrayElem(i)
+			elemEnc(e, v.Index(i), fieldOptions{})
 		}
-		e.WriteByte(']')
-	case reflect.Ptr:
+		e.arrayEnd()
+	}
+}
+
+func newPtrEncoder(t reflect.Type) encoderFunc {
+	elemEnc := typeEncoder(t.Elem())
+	return func(e *encodeState, v reflect.Value, opts fieldOptions) {
 		if v.IsNil() {
-			e.WriteString("null")
+			e.writeNull()
 			return
 		}
-		e.reflectValue(v.Elem(), false)
-	default:
-		fmt.Println(v, t, t.Kind())
-		panic("marshal unsupport type")
+		key := e.enterCycleCheck(v)
+		elemEnc(e, v.Elem(), opts)
+		e.leaveCycleCheck(key)
 	}
 }
 
-func marshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
+// newCondAddrEncoder 可以取地址时使用 canAddrEnc，否则使用 elseEnc
+func newCondAddrEncoder(canAddrEnc, elseEnc encoderFunc) encoderFunc {
+	return func(e *encodeState, v reflect.Value, opts fieldOptions) {
+		if v.CanAddr() {
+			canAddrEnc(e, v, opts)
+		} else {
+			elseEnc(e, v, opts)
+		}
+	}
+}
+
+// writeNull 写入 null
+func (e *encodeState) writeNull() {
+	if e.b != nil {
+		e.b.next()
+		return
+	}
+	e.WriteString("null")
+}
+
+// writeBool 写入 true false，quoted 时使用双引号包裹
+func (e *encodeState) writeBool(t, quoted bool) {
+	if e.b != nil {
+		v := e.b.next()
+		if quoted {
+			LeptSetString(v, strconv.FormatBool(t))
+		} else if t {
+			LeptSetBoolean(v, 1)
+		} else {
+			LeptSetBoolean(v, 0)
+		}
+		return
+	}
+	if quoted {
+		e.WriteByte('"')
+	}
+	if t {
+		e.WriteString("true")
+	} else {
+		e.WriteString("false")
+	}
+	if quoted {
+		e.WriteByte('"')
+	}
+}
+
+// writeNonFinite 按照 e.opts.nonFinite 写入 NaN 以及 ±Infinity，错误交给 marshal 返回
+func (e *encodeState) writeNonFinite(f float64, v reflect.Value) {
+	if e.b != nil {
+		var buf bytes.Buffer
+		if err := leptWriteNonFinite(&buf, f, e.opts, v); err != nil {
+			panic(err)
+		}
+		e.b.raw(buf.String())
+		return
+	}
+	if err := leptWriteNonFinite(&e.Buffer, f, e.opts, v); err != nil {
+		panic(err)
+	}
+}
+
+// writeLeptValue 按照 e.opts 写入 v，错误交给 marshal 返回
+func (e *encodeState) writeLeptValue(v *LeptValue) {
+	if e.b != nil {
+		var buf bytes.Buffer
+		if err := leptWriteValue(&buf, v, e.opts); err != nil {
+			panic(err)
+		}
+		e.b.raw(buf.String())
+		return
+	}
+	if err := leptWriteValue(&e.Buffer, v, e.opts); err != nil {
+		panic(err)
+	}
+}
+
+// objectStart objectKey objectEnd 写入 object，objectKey 的 i 是 key 的序号，
+// nameJSON 是预先生成的 "name": ，不需要转义时直接写入
+func (e *encodeState) objectStart() {
+	if e.b != nil {
+		v := e.b.next()
+		LeptSetObject(v)
+		e.b.stack = append(e.b.stack, v)
+		return
+	}
+	e.WriteByte('{')
+}
+
+func (e *encodeState) objectKey(i int, name, nameJSON string) {
+	if e.b != nil {
+		key, err := leptBuildString(name, e.opts)
+		if err != nil {
+			panic(err)
+		}
+		e.b.key = key
+		return
+	}
+	if i > 0 {
+		e.WriteByte(',')
+	}
+	if nameJSON != "" && !e.escapes() {
+		e.WriteString(nameJSON)
+		return
+	}
+	e.writeString(name)
+	e.WriteByte(':')
+}
+
+func (e *encodeState) objectEnd() {
+	if e.b != nil {
+		e.b.stack = e.b.stack[:len(e.b.stack)-1]
+		return
+	}
+	e.WriteByte('}')
+}
+
+// arrayStart arrayElem arrayEnd 写入 array，arrayElem 的 i 是元素的序号
+func (e *encodeState) arrayStart() {
+	if e.b != nil {
+		v := e.b.next()
+		LeptSetArray(v)
+		e.b.stack = append(e.b.stack, v)
+		return
+	}
+	e.WriteByte('[')
+}
+
+func (e *encodeState) arrayElem(i int) {
+	if e.b == nil && i > 0 {
+		e.WriteByte(',')
+	}
+}
+
+func (e *encodeState) arrayEnd() {
+	if e.b != nil {
+		e.b.stack = e.b.stack[:len(e.b.stack)-1]
+		return
+	}
+	e.WriteByte(']')
+}
+
+// writeQuoted 写入数字，quoted 时使用双引号包裹
+func (e *encodeState) writeQuoted(b []byte, quoted bool) {
+	if e.b != nil {
+		if quoted {
+			LeptSetString(e.b.next(), string(b))
+		} else {
+			e.b.raw(string(b))
+		}
+		return
+	}
+	if quoted {
+		e.WriteByte('"')
+	}
+	e.Write(b)
+	if quoted {
+		e.WriteByte('"')
+	}
+}
+
+func marshalerEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
 	if v.Kind() == reflect.Ptr && v.IsNil() {
-		e.WriteString("null")
+		e.writeNull()
 		return
 	}
 	m := v.Interface().(Marshaler)
@@ -1966,13 +3968,13 @@ func marshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
 	if err != nil {
 		panic(err)
 	}
-	e.Write(b)
+	e.writeMarshaled(b, v.Type())
 }
 
-func addrMarshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
+func addrMarshalerEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
 	va := v.Addr()
 	if va.IsNil() {
-		e.WriteString("null")
+		e.writeNull()
 		return
 	}
 	m := va.Interface().(Marshaler)
@@ -1980,5 +3982,187 @@ func addrMarshalerEncoder(e *encodeState, v reflect.Value, quoted bool) {
 	if err != nil {
 		panic(err)
 	}
-	e.Write(b)
+	e.writeMarshaled(b, va.Type())
+}
+
+// writeMarshaled 检查 MarshalJSON 返回的是合法的 json 之后原样写入
+func (e *encodeState) writeMarshaled(b []byte, t reflect.Type) {
+	if event := LeptValid(string(b)); event != LeptParseOK {
+		panic(fmt.Errorf("MarshalJSON of %v returned invalid json: %v", t, event))
+	}
+	if e.b != nil {
+		// 和写入 json 一样先按照 e.opts 处理非法的 UTF-8，再解析
+		if e.escapes() {
+			var buf bytes.Buffer
+			if err := leptEscapeRaw(&buf, b, e.opts); err != nil {
+				panic(err)
+			}
+			b = buf.Bytes()
+		}
+		e.b.raw(string(b))
+	} else if !e.escapes() {
+		e.Write(b)
+	} else if err := leptEscapeRaw(&e.Buffer, b, e.opts); err != nil {
+		panic(err)
+	}
+}
+
+// writeString 按照 e.opts 写入转义之后的 s，错误交给 marshal 返回
+func (e *encodeState) writeString(s string) {
+	if e.b != nil {
+		s, err := leptBuildString(s, e.opts)
+		if err != nil {
+			panic(err)
+		}
+		LeptSetString(e.b.next(), s)
+		return
+	}
+	if err := leptWriteString(&e.Buffer, s, e.opts); err != nil {
+		panic(err)
+	}
+}
+
+// leptBuildString 按照 o 处理 s 中非法的 UTF-8，结果和 leptWriteString 写入之后再解析相同：
+// UTF8Reject 返回错误，UTF8Replace 以及 EscapeASCII 时每个非法的字节替换为 U+FFFD
+func leptBuildString(s string, o *options) (string, error) {
+	if utf8.ValidString(s) {
+		return s, nil
+	}
+	if o.utf8 == UTF8Reject {
+		return "", &InvalidUTF8Error{S: s}
+	}
+	if o.utf8 == UTF8PassThrough && !o.escapeASCII {
+		return s, nil
+	}
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			sb.WriteRune(utf8.RuneError)
+		} else {
+			sb.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return sb.String(), nil
+}
+
+// escapes 判断字符串是否需要 EscapeHTML EscapeASCII 或者 UTF8Policy 的处理
+func (e *encodeState) escapes() bool {
+	return e.opts.escapeHTML || e.opts.escapeASCII || e.opts.utf8 != UTF8PassThrough
+}
+
+// leptEscapeRaw 对合法的 json src 中的字符串按照 o 转义以及处理非法的 UTF-8，
+// < > & 以及非 ASCII 字符只会出现在字符串中，所以不需要区分字符串的边界
+func leptEscapeRaw(dst *bytes.Buffer, src []byte, o *options) error {
+	s := string(src)
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if o.escapeHTML && (c == '<' || c == '>' || c == '&') {
+			dst.WriteString(s[start:i])
+			leptWriteEscapedRune(dst, rune(c))
+			i++
+			start = i
+		} else if c >= utf8.RuneSelf {
+			dst.WriteString(s[start:i])
+			size, err := leptWriteNonASCII(dst, s, i, o)
+			if err != nil {
+				return err
+			}
+			i += size
+			start = i
+		} else {
+			i++
+		}
+	}
+	dst.WriteString(s[start:])
+	return nil
+}
+
+func textMarshalerEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		e.writeNull()
+		return
+	}
+	m := v.Interface().(encoding.TextMarshaler)
+	b, err := m.MarshalText()
+	if err != nil {
+		panic(err)
+	}
+	e.writeString(string(b))
+}
+
+func addrTextMarshalerEncoder(e *encodeState, v reflect.Value, opts fieldOptions) {
+	va := v.Addr()
+	if va.IsNil() {
+		e.writeNull()
+		return
+	}
+	m := va.Interface().(encoding.TextMarshaler)
+	b, err := m.MarshalText()
+	if err != nil {
+		panic(err)
+	}
+	e.writeString(string(b))
+}
+
+// reflectWithString 保存 map 的 key 和编码之后的字符串，用于排序
+type reflectWithString struct {
+	v reflect.Value
+	s string
+}
+
+// resolve 和 encoding/json 一样，string 优先于 encoding.TextMarshaler，
+// 最后才是 int uint 的十进制字符串
+func (w *reflectWithString) resolve() error {
+	if w.v.Kind() == reflect.String {
+		w.s = w.v.String()
+		return nil
+	}
+	if tm, ok := w.v.Interface().(encoding.TextMarshaler); ok {
+		if w.v.Kind() == reflect.Ptr && w.v.IsNil() {
+			return nil
+		}
+		buf, err := tm.MarshalText()
+		w.s = string(buf)
+		return err
+	}
+	switch w.v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.s = strconv.FormatInt(w.v.Int(), 10)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.s = strconv.FormatUint(w.v.Uint(), 10)
+		return nil
+	}
+	return fmt.Errorf("map key type is unsupported: %v", w.v.Type())
+}
+
+// FromInterface 将 x 转换为 LeptValue，使用 Marshal 的编码器直接构造 LeptValue，规则和 Marshal 完全相同，
+// 结果和 Marshal 之后再 LeptParse 一致，opts 同样可以使用 FieldNaming NonFinite 等选项。
+// NonFiniteJSON5 输出的 NaN Infinity 不是合法的 json，这里和 NonFiniteError 一样返回错误。
+// 超过 2^53 的整数以及 Number 保留原始文本，解析到 int64 uint64 Number 时不丢失精度
+func FromInterface(x interface{}, opts ...Option) (*LeptValue, error) {
+	e := &encodeState{opts: newOptions(opts), b: &leptBuilder{}}
+	if e.opts.nonFinite == NonFiniteJSON5 {
+		e.opts.nonFinite = NonFiniteError
+	}
+	if err := e.marshal(x); err != nil {
+		return nil, err
+	}
+	return e.b.root, nil
+}
+
+// FromStruct 和 FromInterface 一样，但是 structure 必须是 struct 或者 struct 指针
+func FromStruct(structure interface{}, opts ...Option) (*LeptValue, error) {
+	rv := reflect.ValueOf(structure)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("structure is not a struct: %v", reflect.TypeOf(structure))
+	}
+	return FromInterface(structure, opts...)
 }
@@ -1,11 +1,19 @@
 package goleptjson
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
+	"net"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode/utf8"
+	"unsafe"
 )
 
 func expectEQBool(t *testing.T, expect, actual bool) {
@@ -567,6 +575,24 @@ func TestAccessString(t *testing.T) {
 	expectEQString(t, "Hello", LeptGetString(v))
 }
 
+func TestAccessArray(t *testing.T) {
+	a := NewLeptValue()
+	for j := 0; j <= 5; j += 5 {
+		LeptSetArray(a)
+		expectEQLeptType(t, LeptArray, LeptGetType(a))
+		expectEQInt(t, 0, LeptGetArraySize(a))
+		for i := 0; i < 10; i++ {
+			LeptSetNumber(LeptPushBackArrayElement(a), float64(i))
+		}
+		expectEQInt(t, 10, LeptGetArraySize(a))
+		for i := 0; i < 10; i++ {
+			expectEQFloat64(t, float64(i), LeptGetNumber(LeptGetArrayElement(a, i)))
+		}
+	}
+	expectEQLeptType(t, LeptNull, LeptGetType(LeptPushBackArrayElement(a)))
+	expectEQString(t, "[0,1,2,3,4,5,6,7,8,9,null]", LeptStringify(a))
+}
+
 func TestAccessObject(t *testing.T) {
 	o := NewLeptValue()
 	for j := 0; j <= 5; j += 5 {
@@ -576,12 +602,12 @@ func TestAccessObject(t *testing.T) {
 			key := 'a' + i
 			v := NewLeptValue()
 			LeptSetNumber(v, float64(i))
-			LeptMove(LeptSetObjectValue(o, string(key)), v)
+			LeptMove(LeptSetObjectValue(o, string(rune(key))), v)
 		}
 		expectEQInt(t, 10, LeptGetObjectSize(o))
 		for i := 0; i < 10; i++ {
 			key := 'a' + i
-			index := LeptFindObjectIndex(o, string(key))
+			index := LeptFindObjectIndex(o, string(rune(key)))
 			expectEQBool(t, true, index-LeptKeyNotExist != 0)
 			pv := LeptGetObjectValue(o, index)
 			expectEQFloat64(t, float64(i), LeptGetNumber(pv))
@@ -606,7 +632,7 @@ func TestAccessObject(t *testing.T) {
 	{
 		for i := 0; i < 8; i++ {
 			key := 'a' + i + 1
-			index := LeptFindObjectIndex(o, string(key))
+			index := LeptFindObjectIndex(o, string(rune(key)))
 			expectEQBool(t, true, index-LeptKeyNotExist != 0)
 			pv := LeptGetObjectValue(o, index)
 			expectEQFloat64(t, float64(i+1), LeptGetNumber(pv))
@@ -636,36 +662,58 @@ func TestLeptStringify(t *testing.T) {
 		expectEQString(t, c.input, actual)
 	}
 
+	// 和 ECMAScript 的 Number.prototype.toString 输出一致
 	numbers := []struct {
-		input string
+		input  string
+		expect string
 	}{
-		{"0"},
-		// {"-0"},
-		{"1"},
-		{"-1"},
-		{"1.5"},
-		{"-1.5"},
-		{"3.25"},
-		{"1e+20"},
-		{"1.234e+20"},
-		{"1.234e-20"},
-
-		{"1.0000000000000002"},
-		{"4.9406564584124654e-324"},
-		{"-4.9406564584124654e-324"},
-		{"2.2250738585072009e-308"},
-		{"-2.2250738585072009e-308"},
-		{"2.2250738585072014e-308"},
-		{"-2.2250738585072014e-308"},
-		{"1.7976931348623157e+308"},
-		{"-1.7976931348623157e+308"},
+		{"0", "0"},
+		{"-0", "0"},
+		{"-0.0", "0"},
+		{"1", "1"},
+		{"-1", "-1"},
+		{"1.5", "1.5"},
+		{"-1.5", "-1.5"},
+		{"3.25", "3.25"},
+		{"0.1", "0.1"},
+		{"0.3", "0.3"},
+		{"100", "100"},
+		{"1E10", "10000000000"},
+		{"1e+20", "100000000000000000000"},
+		{"1.234e+20", "123400000000000000000"},
+		{"1e21", "1e+21"},
+		{"1.5e21", "1.5e+21"},
+		{"123456789012345680000", "123456789012345680000"},
+		{"0.000001", "0.000001"},
+		{"0.0000001", "1e-7"},
+		{"1.5e-7", "1.5e-7"},
+		{"1.234e-20", "1.234e-20"},
+		{"9007199254740993", "9007199254740992"},
+
+		{"1.0000000000000002", "1.0000000000000002"},
+		{"4.9406564584124654e-324", "5e-324"},
+		{"-4.9406564584124654e-324", "-5e-324"},
+		{"2.2250738585072009e-308", "2.225073858507201e-308"},
+		{"-2.2250738585072009e-308", "-2.225073858507201e-308"},
+		{"2.2250738585072014e-308", "2.2250738585072014e-308"},
+		{"-2.2250738585072014e-308", "-2.2250738585072014e-308"},
+		{"1.7976931348623157e+308", "1.7976931348623157e+308"},
+		{"-1.7976931348623157e+308", "-1.7976931348623157e+308"},
 	}
 	for _, c := range numbers {
 		v := NewLeptValue()
 		expectEQLeptEvent(t, LeptParseOK, LeptParse(v, c.input))
 		actual := LeptStringify(v)
-		expectEQString(t, c.input, actual)
-		// 不完全正确的解析
+		expectEQString(t, c.expect, actual)
+		// 和 Marshal 使用的 'g', -1 是同一个最短的数字，只是格式不同
+		b, err := Marshal(LeptGetNumber(v))
+		if err != nil {
+			t.Errorf("Marshal expect no err: %v", err)
+		}
+		expectEQString(t, shortestDigits(string(b)), shortestDigits(actual))
+		back := NewLeptValue()
+		expectEQLeptEvent(t, LeptParseOK, LeptParse(back, actual))
+		expectEQFloat64(t, LeptGetNumber(v), LeptGetNumber(back))
 	}
 
 	strings := []struct {
@@ -711,6 +759,16 @@ func TestLeptStringify(t *testing.T) {
 	}
 }
 
+// shortestDigits 返回数字文本中去掉符号 小数点 指数和首尾 0 的有效数字
+func shortestDigits(s string) string {
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimPrefix(s, "-")
+	s = strings.Replace(s, ".", "", 1)
+	return strings.Trim(s, "0")
+}
+
 func TestLeptIsEqual(t *testing.T) {
 	valid := []struct {
 		inputLeft  string
@@ -898,7 +956,7 @@ func TestToStruct(t *testing.T) {
 		"\"fp\" : false , " +
 		"\"fpp\" : false , " +
 		"\"tpp\" : true , " +
-		"\"E\" : 4.1, " +
+		"\"E\" : 4, " +
 		"\"Subs\" : " + subsStr + ", " +
 		"\"Sub\" : " + subStr + ", " +
 		"\"IO\" : { \"1\" : 1, \"2\" : 2, \"3\" : 3 }, " +
@@ -1102,6 +1160,627 @@ func TestToStructArray(t *testing.T) {
 	}
 }
 
+func TestToStructNumberRange(t *testing.T) {
+	type numbers struct {
+		I   int     `json:"I"`
+		I8  int8    `json:"I8"`
+		I16 int16   `json:"I16"`
+		I32 int32   `json:"I32"`
+		I64 int64   `json:"I64"`
+		U   uint    `json:"U"`
+		U8  uint8   `json:"U8"`
+		U16 uint16  `json:"U16"`
+		U32 uint32  `json:"U32"`
+		U64 uint64  `json:"U64"`
+		UP  uintptr `json:"UP"`
+		F32 float32 `json:"F32"`
+	}
+	valid := []struct {
+		input  string
+		expect numbers
+	}{
+		{"{\"I8\":127,\"I16\":32767,\"I32\":2147483647,\"I64\":9223372036854774784}",
+			numbers{I8: 127, I16: 32767, I32: 2147483647, I64: 9223372036854774784}},
+		{"{\"I8\":-128,\"I16\":-32768,\"I32\":-2147483648,\"I64\":-9223372036854775808}",
+			numbers{I8: -128, I16: -32768, I32: -2147483648, I64: -9223372036854775808}},
+		{"{\"U8\":255,\"U16\":65535,\"U32\":4294967295,\"U64\":18446744073709549568}",
+			numbers{U8: 255, U16: 65535, U32: 4294967295, U64: 18446744073709549568}},
+		{"{\"I\":-1e3,\"U\":1e3,\"UP\":1.0,\"F32\":1.5}",
+			numbers{I: -1000, U: 1000, UP: 1, F32: 1.5}},
+		// 超过 2^53 的整数使用原始文本，不经过 float64
+		{"{\"I64\":9223372036854775807,\"U64\":18446744073709551615}",
+			numbers{I64: math.MaxInt64, U64: math.MaxUint64}},
+		{"{\"I64\":-9223372036854775808,\"U64\":9007199254740993}",
+			numbers{I64: math.MinInt64, U64: 1<<53 + 1}},
+		{"{\"I64\":9007199254740993,\"U\":-0}",
+			numbers{I64: 1<<53 + 1}},
+	}
+	for _, c := range valid {
+		v := NewLeptValue()
+		expectEQLeptEvent(t, LeptParseOK, LeptParse(v, c.input))
+		actual := numbers{}
+		if err := ToStruct(v, &actual); err != nil {
+			t.Errorf("ToStruct %v expect no err: %v", c.input, err)
+		} else if actual != c.expect {
+			t.Errorf("ToStruct %v expect: %+v, actual: %+v", c.input, c.expect, actual)
+		}
+		actual = numbers{}
+		if err := Unmarshal([]byte(c.input), &actual); err != nil {
+			t.Errorf("Unmarshal %v expect no err: %v", c.input, err)
+		} else if actual != c.expect {
+			t.Errorf("Unmarshal %v expect: %+v, actual: %+v", c.input, c.expect, actual)
+		}
+	}
+	invalid := []string{
+		"{\"I\":1.5}",
+		"{\"I8\":128}",
+		"{\"I8\":-129}",
+		"{\"I16\":32768}",
+		"{\"I16\":-32769}",
+		"{\"I32\":2147483648}",
+		"{\"I32\":-2147483649}",
+		"{\"I64\":9223372036854775808}",
+		"{\"I64\":-1e19}",
+		"{\"I64\":0.5}",
+		"{\"U\":-1}",
+		"{\"U8\":256}",
+		"{\"U8\":1.5}",
+		"{\"U16\":65536}",
+		"{\"U32\":4294967296}",
+		"{\"U64\":18446744073709551616}",
+		"{\"U64\":-1}",
+		"{\"UP\":-1}",
+		"{\"F32\":1e39}",
+	}
+	for _, input := range invalid {
+		v := NewLeptValue()
+		expectEQLeptEvent(t, LeptParseOK, LeptParse(v, input))
+		actual := numbers{}
+		if err := ToStruct(v, &actual); err == nil {
+			t.Errorf("ToStruct %v expect err, actual: %+v", input, actual)
+		}
+	}
+}
+
+// textColor 用于测试 encoding.TextMarshaler encoding.TextUnmarshaler
+type textColor int
+
+const (
+	textRed textColor = iota
+	textGreen
+)
+
+func (c textColor) MarshalText() ([]byte, error) {
+	switch c {
+	case textRed:
+		return []byte("red"), nil
+	case textGreen:
+		return []byte("green"), nil
+	}
+	return nil, fmt.Errorf("textColor %d is unknown", int(c))
+}
+
+func (c *textColor) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "red":
+		*c = textRed
+	case "green":
+		*c = textGreen
+	default:
+		return fmt.Errorf("textColor %q is unknown", string(b))
+	}
+	return nil
+}
+
+func TestTextMarshaler(t *testing.T) {
+	type obj struct {
+		IP    net.IP               `json:"ip"`
+		Time  time.Time            `json:"time"`
+		Color textColor            `json:"color"`
+		CP    *textColor           `json:"cp"`
+		Keys  map[textColor]string `json:"keys"`
+	}
+	green := textGreen
+	input := obj{
+		IP:    net.ParseIP("192.168.0.1"),
+		Time:  time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Color: textGreen,
+		CP:    &green,
+		Keys:  map[textColor]string{textRed: "r", textGreen: "g"},
+	}
+	buf, err := Marshal(input)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	ebuf, err := json.Marshal(input)
+	if err != nil {
+		t.Errorf("json.Marshal expect no err: %v", err)
+	}
+	expectEQString(t, string(ebuf), string(buf))
+
+	v := NewLeptValue()
+	expectEQLeptEvent(t, LeptParseOK, LeptParse(v, string(buf)))
+	actual := obj{}
+	if err := ToStruct(v, &actual); err != nil {
+		t.Errorf("ToStruct expect no err: %v", err)
+	} else {
+		expectEQBool(t, true, actual.IP.Equal(input.IP))
+		expectEQBool(t, true, actual.Time.Equal(input.Time))
+		expectEQBool(t, true, actual.Color == textGreen)
+		expectEQBool(t, true, actual.CP != nil && *actual.CP == textGreen)
+		expectEQBool(t, true, reflect.DeepEqual(input.Keys, actual.Keys))
+	}
+
+	invalid := []string{
+		"{\"color\":1}",
+		"{\"color\":\"blue\"}",
+		"{\"keys\":{\"blue\":\"b\"}}",
+		"{\"ip\":\"not an ip\"}",
+	}
+	for _, input := range invalid {
+		v := NewLeptValue()
+		expectEQLeptEvent(t, LeptParseOK, LeptParse(v, input))
+		if err := ToStruct(v, &obj{}); err == nil {
+			t.Errorf("ToStruct %v expect err", input)
+		}
+	}
+	if _, err := Marshal(textColor(3)); err == nil {
+		t.Errorf("Marshal unknown textColor expect err")
+	}
+}
+
+func TestMapKey(t *testing.T) {
+	type key string
+	type obj struct {
+		I  map[int]string    `json:"i"`
+		I8 map[int8]int      `json:"i8"`
+		U  map[uint16]bool   `json:"u"`
+		K  map[key]int       `json:"k"`
+		T  map[textColor]int `json:"t"`
+	}
+	input := obj{
+		I:  map[int]string{-1: "a", 2: "b", 10: "c"},
+		I8: map[int8]int{-128: 1, 127: 2},
+		U:  map[uint16]bool{65535: true, 0: false},
+		K:  map[key]int{"b": 2, "a": 1},
+		T:  map[textColor]int{textGreen: 1, textRed: 0},
+	}
+	buf, err := Marshal(input)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	ebuf, err := json.Marshal(input)
+	if err != nil {
+		t.Errorf("json.Marshal expect no err: %v", err)
+	}
+	expectEQString(t, string(ebuf), string(buf))
+
+	v := NewLeptValue()
+	expectEQLeptEvent(t, LeptParseOK, LeptParse(v, string(buf)))
+	actual := obj{}
+	if err := ToStruct(v, &actual); err != nil {
+		t.Errorf("ToStruct expect no err: %v", err)
+	} else if !reflect.DeepEqual(input, actual) {
+		t.Errorf("ToStruct expect: %v, actual: %v", input, actual)
+	}
+
+	invalid := []string{
+		"{\"i\":{\"a\":\"a\"}}",
+		"{\"i\":{\"1.5\":\"a\"}}",
+		"{\"i8\":{\"128\":1}}",
+		"{\"u\":{\"-1\":true}}",
+		"{\"u\":{\"65536\":true}}",
+	}
+	for _, input := range invalid {
+		v := NewLeptValue()
+		expectEQLeptEvent(t, LeptParseOK, LeptParse(v, input))
+		if err := ToStruct(v, &obj{}); err == nil {
+			t.Errorf("ToStruct %v expect err", input)
+		}
+	}
+	{
+		v := NewLeptValue()
+		expectEQLeptEvent(t, LeptParseOK, LeptParse(v, "{}"))
+		var m map[float64]int
+		if err := ToStruct(v, &m); err == nil {
+			t.Errorf("ToStruct map[float64]int expect err")
+		}
+		if _, err := Marshal(map[float64]int{1.5: 1}); err == nil {
+			t.Errorf("Marshal map[float64]int expect err")
+		}
+	}
+}
+
+func TestBytes(t *testing.T) {
+	type obj struct {
+		B []byte  `json:"b"`
+		N []byte  `json:"n"`
+		E []byte  `json:"e"`
+		P *[]byte `json:"p"`
+	}
+	p := []byte("pointer")
+	input := obj{B: []byte{1, 2, 3, 255}, E: []byte{}, P: &p}
+	buf, err := Marshal(input)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	ebuf, err := json.Marshal(input)
+	if err != nil {
+		t.Errorf("json.Marshal expect no err: %v", err)
+	}
+	expectEQString(t, string(ebuf), string(buf))
+	{
+		actual := obj{}
+		if err := Unmarshal(buf, &actual); err != nil {
+			t.Errorf("Unmarshal expect no err: %v", err)
+		} else if !reflect.DeepEqual(input, actual) {
+			t.Errorf("Unmarshal expect: %v, actual: %v", input, actual)
+		}
+	}
+
+	valid := []struct {
+		input  string
+		expect []byte
+	}{
+		{"{\"b\":\"AQI=\"}", []byte{1, 2}},
+		{"{\"b\":\"AQI\"}", []byte{1, 2}},
+		{"{\"b\":\"\"}", []byte{}},
+		{"{\"b\":[1,2]}", []byte{1, 2}},
+	}
+	for _, c := range valid {
+		actual := obj{}
+		if err := Unmarshal([]byte(c.input), &actual); err != nil {
+			t.Errorf("Unmarshal %v expect no err: %v", c.input, err)
+		} else if !reflect.DeepEqual(c.expect, actual.B) {
+			t.Errorf("Unmarshal %v expect: %v, actual: %v", c.input, c.expect, actual.B)
+		}
+	}
+	if err := Unmarshal([]byte("{\"b\":\"!!\"}"), &obj{}); err == nil {
+		t.Errorf("Unmarshal invalid base64 expect err")
+	}
+
+	type arr struct {
+		A []byte `json:"a,array"`
+	}
+	buf, err = Marshal(arr{A: []byte{1, 2, 3}})
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	expectEQString(t, "{\"a\":[1,2,3]}", string(buf))
+	{
+		actual := arr{}
+		if err := Unmarshal(buf, &actual); err != nil {
+			t.Errorf("Unmarshal expect no err: %v", err)
+		} else if !reflect.DeepEqual([]byte{1, 2, 3}, actual.A) {
+			t.Errorf("Unmarshal expect: [1 2 3], actual: %v", actual.A)
+		}
+		if err := Unmarshal([]byte("{\"a\":\"AQID\"}"), &actual); err == nil {
+			t.Errorf("Unmarshal base64 into array option expect err")
+		}
+	}
+}
+
+func TestQuotedOption(t *testing.T) {
+	type obj struct {
+		ID  int64   `json:"id,string"`
+		U   uint8   `json:"u,string"`
+		F   float64 `json:"f,string"`
+		B   bool    `json:"b,string"`
+		S   string  `json:"s,string"`
+		P   *int    `json:"p,string"`
+		NP  *int    `json:"np,string"`
+		A   []int   `json:"a,string"`
+		Raw int64   `json:"raw"`
+	}
+	p := 7
+	input := obj{ID: 9007199254740993, U: 255, F: 1.5, B: true, S: "abc", P: &p, A: []int{1}, Raw: 1}
+	buf, err := Marshal(input)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	ebuf, err := json.Marshal(input)
+	if err != nil {
+		t.Errorf("json.Marshal expect no err: %v", err)
+	}
+	expectEQString(t, string(ebuf), string(buf))
+	{
+		actual := obj{}
+		if err := Unmarshal(buf, &actual); err != nil {
+			t.Errorf("Unmarshal expect no err: %v", err)
+		} else if actual.ID != input.ID || actual.U != input.U || actual.F != input.F ||
+			actual.B != input.B || actual.S != input.S || *actual.P != p || len(actual.A) != 1 {
+			t.Errorf("Unmarshal expect: %v, actual: %v", input, actual)
+		}
+	}
+	valid := []struct {
+		input  string
+		expect obj
+	}{
+		{"{\"id\":\"-9223372036854775808\"}", obj{ID: -9223372036854775808}},
+		{"{\"id\":\"1e3\"}", obj{ID: 1000}},
+		{"{\"id\":null,\"f\":\"null\"}", obj{}},
+		{"{\"f\":\"-1.25e2\",\"b\":\"false\"}", obj{F: -125}},
+		{"{\"s\":\"\\\"x\\\\ty\\\"\"}", obj{S: "x\ty"}},
+	}
+	for _, c := range valid {
+		actual := obj{}
+		if err := Unmarshal([]byte(c.input), &actual); err != nil {
+			t.Errorf("Unmarshal %v expect no err: %v", c.input, err)
+			continue
+		}
+		// 缺少的指针字段会被初始化，这里只比较其他字段
+		actual.P, actual.NP = nil, nil
+		if !reflect.DeepEqual(c.expect, actual) {
+			t.Errorf("Unmarshal %v expect: %v, actual: %v", c.input, c.expect, actual)
+		}
+	}
+	invalid := []string{
+		"{\"id\":123}",
+		"{\"id\":\"abc\"}",
+		"{\"id\":\"1.5\"}",
+		"{\"id\":\"9223372036854775808\"}",
+		"{\"id\":\" 1\"}",
+		"{\"u\":\"256\"}",
+		"{\"u\":\"-1\"}",
+		"{\"f\":\"true\"}",
+		"{\"b\":\"yes\"}",
+		"{\"b\":true}",
+		"{\"s\":\"abc\"}",
+		"{\"s\":\"1\"}",
+	}
+	for _, input := range invalid {
+		if err := Unmarshal([]byte(input), &obj{}); err == nil {
+			t.Errorf("Unmarshal %v expect err", input)
+		}
+	}
+}
+
+// cacheNode 是一个递归类型，用于测试 typeEncoder 的缓存
+type cacheNode struct {
+	Name     string       `json:"name"`
+	Next     *cacheNode   `json:"next,omitempty"`
+	Children []*cacheNode `json:"children"`
+	Untagged int
+}
+
+func TestTypeFieldsCache(t *testing.T) {
+	input := &cacheNode{
+		Name:     "root",
+		Next:     &cacheNode{Name: "next"},
+		Children: []*cacheNode{{Name: "child", Untagged: 1}},
+	}
+	ebuf, err := json.Marshal(input)
+	if err != nil {
+		t.Errorf("json.Marshal expect no err: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf, err := Marshal(input)
+			if err != nil {
+				t.Errorf("Marshal expect no err: %v", err)
+				return
+			}
+			expectEQString(t, string(ebuf), string(buf))
+			actual := &cacheNode{}
+			if err := Unmarshal(buf, actual); err != nil {
+				t.Errorf("Unmarshal expect no err: %v", err)
+				return
+			}
+			expectEQString(t, "next", actual.Next.Name)
+			expectEQInt(t, 1, actual.Children[0].Untagged)
+		}()
+	}
+	wg.Wait()
+
+	fields := cachedTypeFields(reflect.TypeOf(cacheNode{}))
+	expectEQInt(t, 4, len(fields.list))
+	expectEQBool(t, true, fields == cachedTypeFields(reflect.TypeOf(cacheNode{})))
+	expectEQString(t, "Untagged", fields.list[fields.byName["Untagged"]].name)
+	expectEQBool(t, true, fields.list[fields.byName["next"]].omitEmpty)
+}
+
+func TestTypeDecoderCache(t *testing.T) {
+	// 普通的类型直接按照 Kind 解析，指针和实现了 Unmarshaler TextUnmarshaler 的类型经过 indirect
+	tests := []struct {
+		typ      reflect.Type
+		indirect bool
+	}{
+		{reflect.TypeOf(cacheNode{}), false},
+		{reflect.TypeOf([]int{}), false},
+		{reflect.TypeOf(&cacheNode{}), true},
+		{reflect.TypeOf(new(interface{})).Elem(), true},
+		{reflect.TypeOf(textColor(0)), true},
+		{reflect.TypeOf(RawMessage{}), false},
+	}
+	for _, tt := range tests {
+		f := typeDecoder(tt.typ)
+		expectEQBool(t, tt.indirect, reflect.ValueOf(f).Pointer() == reflect.ValueOf(decoderFunc(indirectDecoder)).Pointer())
+	}
+
+	v := NewLeptValue()
+	expectEQLeptEvent(t, LeptParseOK, LeptParse(v, `{"name":"a","next":{"name":"b"},"children":[{"name":"c"}]}`))
+	for i := 0; i < 2; i++ {
+		actual := cacheNode{}
+		if err := ToStruct(v, &actual); err != nil {
+			t.Errorf("ToStruct expect no err: %v", err)
+		}
+		expectEQString(t, "b", actual.Next.Name)
+		expectEQString(t, "c", actual.Children[0].Name)
+	}
+}
+
+func TestMarshalUnsupportedType(t *testing.T) {
+	tests := []struct {
+		x      interface{}
+		expect string
+	}{
+		{make(chan int), "unsupported type: chan int"},
+		{struct{ F func() }{}, "unsupported type: func()"},
+		{map[string]interface{}{"c": complex(1, 2)}, "unsupported type: complex128"},
+	}
+	for _, tt := range tests {
+		_, err := Marshal(tt.x)
+		_, ok := err.(*UnsupportedTypeError)
+		expectEQBool(t, true, ok)
+		expectEQString(t, tt.expect, fmt.Sprint(err))
+	}
+}
+
+func TestStructFieldNames(t *testing.T) {
+	type names struct {
+		Tagged   int `json:"tagged"`
+		Untagged int
+		Options  int `json:",omitempty"`
+		hidden   int
+		Skip     int `json:"-"`
+	}
+	// 没有指定名字的字段使用字段名，和 encoding/json 一致
+	x := names{Tagged: 1, Untagged: 2, Options: 3, hidden: 4, Skip: 5}
+	buf, err := Marshal(x)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	expectEQString(t, `{"tagged":1,"Untagged":2,"Options":3}`, string(buf))
+
+	// 未导出的字段在解析时同样跳过，不会因为无法设置而 panic
+	var actual names
+	v := NewLeptValue()
+	expectEQLeptEvent(t, LeptParseOK, LeptParse(v, `{"tagged":1,"Untagged":2,"Options":3,"hidden":4,"Skip":5}`))
+	if err := ToStruct(v, &actual); err != nil {
+		t.Errorf("ToStruct expect no err: %v", err)
+	}
+	expectEQBool(t, true, actual == names{Tagged: 1, Untagged: 2, Options: 3})
+	actual = names{}
+	if err := Unmarshal([]byte(`{"Untagged":2,"hidden":4}`), &actual); err != nil {
+		t.Errorf("Unmarshal expect no err: %v", err)
+	}
+	expectEQBool(t, true, actual == names{Untagged: 2})
+}
+
+type decodeInner struct {
+	S string            `json:"s"`
+	N []int             `json:"n"`
+	M map[string]string `json:"m"`
+}
+
+type decodeOuter struct {
+	A int                     `json:"a"`
+	B *decodeInner            `json:"b"`
+	C []decodeInner           `json:"c"`
+	D map[int]*decodeInner    `json:"d"`
+	E interface{}             `json:"e"`
+	F [2]float64              `json:"f"`
+	G textColor               `json:"g"`
+	H int64                   `json:"h,string"`
+	I []byte                  `json:"i"`
+	J map[string]interface{}  `json:"j"`
+	K string                  `json:"k"`
+	L map[float64]interface{} `json:"l"`
+}
+
+// Unmarshal 是单遍解析，结果和错误应该和 LeptParse + ToStruct 一致
+func TestUnmarshalSinglePass(t *testing.T) {
+	tests := []string{
+		`{}`,
+		`{"a":1,"b":{"s":"x\ty","n":[1,2,3],"m":{"k":"v"}},"c":[{"s":"c0"},{"n":[]}]}`,
+		`{"d":{"1":{"s":"d1"},"2":null},"e":{"x":[1,"2",true,null]},"f":[1.5]}`,
+		`{"g":"green","h":"9007199254740993","i":"aGVsbG8=","j":{"a":{"b":[{}]}}}`,
+		`{"unknown":{"x":[1,{"y":"\u4e2d"}]},"k":"known","more":[[],{}]}`,
+		`{"k":"first","k":"second"}`,
+		`{"a":null,"b":null,"c":null,"d":null,"e":null,"h":null}`,
+		`{"a":"1","k":"after type error"}`,
+		`{"a":1.5}`,
+		`{"c":{}}`,
+		`{"g":1}`,
+		`{"d":{"x":{}}}`,
+		`{"l":{"1":1}}`,
+		`[1,2]`,
+		`"string"`,
+		`null`,
+	}
+	for _, input := range tests {
+		expect := &decodeOuter{K: "prefilled", C: []decodeInner{{S: "0"}, {S: "1"}, {S: "2"}}}
+		actual := &decodeOuter{K: "prefilled", C: []decodeInner{{S: "0"}, {S: "1"}, {S: "2"}}}
+		v := NewLeptValue()
+		if event := LeptParse(v, input); event != LeptParseOK {
+			t.Errorf("LeptParse %s expect ok, actual: %v", input, event)
+			continue
+		}
+		eerr := ToStruct(v, expect)
+		aerr := Unmarshal([]byte(input), actual)
+		if fmt.Sprint(eerr) != fmt.Sprint(aerr) {
+			t.Errorf("Unmarshal %s expect err: %v, actual: %v", input, eerr, aerr)
+		}
+		// 出错时已经写入的字段和解析顺序有关，只比较成功的结果
+		if eerr == nil && !reflect.DeepEqual(expect, actual) {
+			t.Errorf("Unmarshal %s expect: %+v, actual: %+v", input, expect, actual)
+		}
+	}
+
+	// 语法错误优先于类型错误，跳过的子树同样需要检查语法
+	parseErrors := []struct {
+		input string
+		event LeptEvent
+	}{
+		{`{"a":"1","k":}`, LeptParseInvalidValue},
+		{`{"unknown":[1,2}`, LeptParseMissCommaOrSouareBracket},
+		{`{"unknown":{"x" 1}}`, LeptParseMissColon},
+		{`{"unknown":{"x":1]}`, LeptParseMissCommaOrCurlyBracket},
+		{`{"unknown":"\x"}`, LeptParseInvalidStringEscape},
+		{`{"a":1} x`, LeptParseRootNotSingular},
+		{`{"c":[{"s":"x"}`, LeptParseMissCommaOrSouareBracket},
+		{`{"a"`, LeptParseMissColon},
+		{``, LeptParseExpectValue},
+	}
+	for _, tt := range parseErrors {
+		err := Unmarshal([]byte(tt.input), &decodeOuter{})
+		expectEQString(t, fmt.Sprintf("Unmarshal parse error: %v", tt.event), fmt.Sprint(err))
+	}
+	err := Unmarshal([]byte(`{"a":1`), decodeOuter{})
+	expectEQString(t, fmt.Sprintf("Unmarshal parse error: %v", LeptParseMissCommaOrCurlyBracket), fmt.Sprint(err))
+	err = Unmarshal([]byte(`{"a":1}`), decodeOuter{})
+	expectEQString(t, "structure is not a ptr: goleptjson.decodeOuter", fmt.Sprint(err))
+}
+
+// stringAliases 判断 s 是否指向 src 的内存
+func stringAliases(s, src string) bool {
+	if s == "" {
+		return false
+	}
+	p := (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+	b := (*reflect.StringHeader)(unsafe.Pointer(&src)).Data
+	return p >= b && p < b+uintptr(len(src))
+}
+
+func TestParseStringCopy(t *testing.T) {
+	// 保存到 LeptValue 以及 Go 值中的字符串不引用输入，否则一个小字段会使整个输入无法回收
+	input := `{"key":"value","m":{"k":"v"},"s":"str"}`
+	v := mustParse(t, input)
+	expectEQBool(t, false, stringAliases(LeptGetString(LeptFindObjectValue(v, "key")), input))
+	expectEQBool(t, false, stringAliases(v.o[0].key, input))
+
+	var x struct {
+		M map[string]string `json:"m"`
+		S string            `json:"s"`
+	}
+	d := &decodeState{c: NewLeptContext(input), opts: newOptions(nil)}
+	expectEQLeptEvent(t, LeptParseOK, d.value(reflect.ValueOf(&x), fieldOptions{}))
+	expectEQString(t, "v", x.M["k"])
+	for k, mv := range x.M {
+		expectEQBool(t, false, stringAliases(k, input))
+		expectEQBool(t, false, stringAliases(mv, input))
+	}
+	expectEQBool(t, false, stringAliases(x.S, input))
+
+	c := NewLeptContext(`"abc"`)
+	s, event := LeptParseStringRaw(c)
+	expectEQLeptEvent(t, LeptParseOK, event)
+	expectEQBool(t, false, stringAliases(s, `"abc"`))
+}
+
 func TestSetValue(t *testing.T) {
 	v := struct {
 		A bool
@@ -1296,3 +1975,1009 @@ func ExampToInterface() {}
 func ExampToMap()       {}
 func ExampToArray()     {}
 func ExampToStruct()    {}
+
+func TestFromInterface(t *testing.T) {
+	type config struct {
+		Name    string            `json:"name"`
+		Port    int               `json:"port"`
+		Ratio   float32           `json:"ratio"`
+		Debug   bool              `json:"debug,omitempty"`
+		ID      int64             `json:"id,string"`
+		Tags    []string          `json:"tags"`
+		Color   textColor         `json:"color"`
+		Key     []byte            `json:"key"`
+		Limits  map[int]uint      `json:"limits"`
+		Extra   interface{}       `json:"extra"`
+		Next    *config           `json:"next"`
+		Labels  map[string]string `json:"labels"`
+		private int
+	}
+	input := &config{
+		Name:   "svc",
+		Port:   8080,
+		Ratio:  0.1,
+		ID:     1 << 60,
+		Tags:   []string{"a", "b"},
+		Color:  textColor(1),
+		Key:    []byte("hello"),
+		Limits: map[int]uint{10: 1, 2: 2},
+		Extra:  []interface{}{1, "x", nil, map[string]interface{}{"y": true}},
+		Next:   &config{Name: "next"},
+	}
+	v, err := FromInterface(input)
+	if err != nil {
+		t.Fatalf("FromInterface expect no err: %v", err)
+	}
+	buf, err := Marshal(input)
+	if err != nil {
+		t.Fatalf("Marshal expect no err: %v", err)
+	}
+	expect := NewLeptValue()
+	expectEQLeptEvent(t, LeptParseOK, LeptParse(expect, string(buf)))
+	if !LeptIsEqual(expect, v) {
+		t.Errorf("FromInterface expect: %s, actual: %s", buf, LeptStringify(v))
+	}
+
+	// 通过 DOM 修改之后再转换回 struct
+	LeptSetNumber(LeptFindObjectValue(v, "port"), 9090)
+	LeptSetString(LeptSetObjectValue(v, "name"), "patched")
+	actual := &config{}
+	if err := ToStruct(v, actual); err != nil {
+		t.Errorf("ToStruct expect no err: %v", err)
+	}
+	expectEQString(t, "patched", actual.Name)
+	expectEQInt(t, 9090, actual.Port)
+	expectEQString(t, "hello", string(actual.Key))
+	expectEQBool(t, true, actual.ID == 1<<60)
+
+	v, err = FromStruct(*input)
+	if err != nil {
+		t.Errorf("FromStruct expect no err: %v", err)
+	}
+	expectEQBool(t, true, LeptIsEqual(expect, v))
+
+	nulls := []interface{}{nil, (*config)(nil), []int(nil), map[string]int(nil)}
+	for _, x := range nulls {
+		v, err := FromInterface(x)
+		if err != nil {
+			t.Errorf("FromInterface %#v expect no err: %v", x, err)
+			continue
+		}
+		expectEQLeptType(t, LeptNull, LeptGetType(v))
+	}
+
+	// 和 Marshal 使用同一套规则，包括循环检测和 NaN Infinity 的处理
+	cycle := &cycleNode{Name: "root"}
+	cycle.Children = []*cycleNode{{Name: "child", Parent: cycle}}
+	errs := []struct {
+		f      func(interface{}, ...Option) (*LeptValue, error)
+		x      interface{}
+		opts   []Option
+		expect string
+	}{
+		{FromStruct, []int{1}, nil, "structure is not a struct: []int"},
+		{FromStruct, nil, nil, "structure is not a struct: <nil>"},
+		{FromInterface, make(chan int), nil, "unsupported type: chan int"},
+		{FromInterface, map[float64]int{1: 1}, nil, "map key type is unsupported: float64"},
+		{FromInterface, struct{ F func() }{}, nil, "unsupported type: func()"},
+		{FromStruct, cycle, nil, "unsupported value: encountered a cycle via []*goleptjson.cycleNode"},
+		{FromInterface, math.NaN(), nil, "unsupported value: NaN"},
+		{FromInterface, []float64{math.Inf(1)}, []Option{NonFinite(NonFiniteJSON5)}, "unsupported value: +Inf"},
+	}
+	for _, tt := range errs {
+		_, err := tt.f(tt.x, tt.opts...)
+		expectEQString(t, tt.expect, fmt.Sprint(err))
+	}
+
+	// Marshal 的选项同样生效
+	v, err = FromInterface(struct {
+		UserID int
+		Score  float64
+	}{1, math.Inf(-1)}, FieldNaming(SnakeCase), NonFinite(NonFiniteNull))
+	if err != nil {
+		t.Errorf("FromInterface expect no err: %v", err)
+	}
+	expectEQString(t, `{"user_id":1,"score":null}`, LeptStringify(v))
+
+	// 直接构造 LeptValue，结果和 Marshal 之后再 LeptParse 相同
+	type quoted struct {
+		B bool    `json:",string"`
+		F float64 `json:",string"`
+		S string  `json:",string"`
+	}
+	same := []struct {
+		x    interface{}
+		opts []Option
+	}{
+		{input, []Option{FieldNaming(KebabCase)}},
+		{map[string]interface{}{"<a>": "é<", "n": Number("1.50"), "q": quoted{true, 1.5, "<x>"}}, []Option{EscapeHTML(), EscapeASCII()}},
+		{map[string]interface{}{"a\xff": "b\xfe", "raw": RawMessage("{\"k\":\"\xfe\"}")}, []Option{InvalidUTF8(UTF8Replace)}},
+		{[]interface{}{"\xff", RawMessage("[\"\xfe\"]")}, []Option{EscapeASCII()}},
+		{[]interface{}{mustParse(t, `{"a":[1,null]}`), LeptValue{}, (*LeptValue)(nil)}, nil},
+		{[]interface{}{textColor(0), []byte("hi"), [2]int{1, 2}, -0.0, float32(0.1)}, nil},
+	}
+	for _, tt := range same {
+		v, err := FromInterface(tt.x, tt.opts...)
+		if err != nil {
+			t.Errorf("FromInterface %#v expect no err: %v", tt.x, err)
+			continue
+		}
+		expect := mustParse(t, string(mustMarshal(t, tt.x, tt.opts...)))
+		if !LeptIsEqual(expect, v) {
+			t.Errorf("FromInterface expect: %s, actual: %s", LeptStringify(expect), LeptStringify(v))
+		}
+	}
+	_, err = FromInterface([]string{"a\xff"}, InvalidUTF8(UTF8Reject))
+	expectEQString(t, `invalid UTF-8 in string: "a\xff"`, fmt.Sprint(err))
+
+	// 超过 2^53 的整数以及 Number 保留原始文本，不丢失精度
+	type exact struct {
+		I int64
+		U uint64
+		N Number
+	}
+	v, err = FromInterface(exact{1<<53 + 1, math.MaxUint64, "1.50"})
+	if err != nil {
+		t.Errorf("FromInterface expect no err: %v", err)
+	}
+	var back exact
+	if err := ToStruct(v, &back); err != nil {
+		t.Errorf("ToStruct expect no err: %v", err)
+	}
+	expectEQString(t, fmt.Sprint(exact{1<<53 + 1, math.MaxUint64, "1.50"}), fmt.Sprint(back))
+}
+
+func TestLeptValueMarshaler(t *testing.T) {
+	type envelope struct {
+		Kind string     `json:"kind"`
+		Data *LeptValue `json:"data"`
+		Meta LeptValue  `json:"meta"`
+	}
+	input := `{"kind":"event","data":{"id":1,"tags":["a","b"],"ok":true},"meta":[null,"x"]}`
+	src := NewLeptValue()
+	expectEQLeptEvent(t, LeptParseOK, LeptParse(src, input))
+	actual := &envelope{}
+	if err := ToStruct(src, actual); err != nil {
+		t.Fatalf("ToStruct expect no err: %v", err)
+	}
+	expectEQLeptType(t, LeptObject, LeptGetType(actual.Data))
+	expectEQLeptType(t, LeptArray, LeptGetType(&actual.Meta))
+	// ToStruct 得到的是深拷贝，修改 src 不会影响 actual
+	LeptSetString(LeptFindObjectValue(LeptFindObjectValue(src, "data"), "ok"), "changed")
+	expectEQLeptType(t, LeptTrue, LeptGetType(LeptFindObjectValue(actual.Data, "ok")))
+
+	buf, err := Marshal(actual)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	expectEQString(t, input, string(buf))
+	// 不能取地址的 LeptValue 同样使用 LeptStringify
+	buf, err = Marshal(*actual)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	expectEQString(t, input, string(buf))
+
+	decoded := &envelope{}
+	if err := Unmarshal([]byte(input), decoded); err != nil {
+		t.Errorf("Unmarshal expect no err: %v", err)
+	}
+	expectEQBool(t, true, LeptIsEqual(actual.Data, decoded.Data))
+	expectEQBool(t, true, LeptIsEqual(&actual.Meta, &decoded.Meta))
+
+	// null 对应 nil 指针以及 LeptNull
+	decoded = &envelope{Data: NewLeptValue()}
+	if err := Unmarshal([]byte(`{"data":null,"meta":null}`), decoded); err != nil {
+		t.Errorf("Unmarshal expect no err: %v", err)
+	}
+	expectEQBool(t, true, decoded.Data == nil)
+	expectEQLeptType(t, LeptNull, LeptGetType(&decoded.Meta))
+	buf, err = Marshal(decoded)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	expectEQString(t, `{"kind":"","data":null,"meta":null}`, string(buf))
+
+	// encoding/json 通过 json.Marshaler json.Unmarshaler 使用 LeptValue
+	jsonDecoded := &envelope{}
+	if err := json.Unmarshal([]byte(input), jsonDecoded); err != nil {
+		t.Errorf("json.Unmarshal expect no err: %v", err)
+	}
+	expectEQBool(t, true, LeptIsEqual(actual.Data, jsonDecoded.Data))
+	jbuf, err := json.Marshal(jsonDecoded)
+	if err != nil {
+		t.Errorf("json.Marshal expect no err: %v", err)
+	}
+	expectEQString(t, input, string(jbuf))
+	if err := json.Unmarshal([]byte(`{"data":[1,}`), jsonDecoded); err == nil {
+		t.Errorf("json.Unmarshal expect err")
+	}
+
+	v, err := FromInterface(actual)
+	if err != nil {
+		t.Errorf("FromInterface expect no err: %v", err)
+	}
+	expectEQString(t, input, LeptStringify(v))
+}
+
+type invalidMarshaler struct{}
+
+func (invalidMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`{"a":}`), nil
+}
+
+func TestRawMessage(t *testing.T) {
+	type envelope struct {
+		Kind string      `json:"kind"`
+		Data RawMessage  `json:"data"`
+		Ptr  *RawMessage `json:"ptr"`
+	}
+	input := `{"kind":"point", "data": { "x" : 1.50, "y":[ 2 ,3] } ,"ptr":"A"}`
+	actual := &envelope{}
+	if err := Unmarshal([]byte(input), actual); err != nil {
+		t.Fatalf("Unmarshal expect no err: %v", err)
+	}
+	expectEQString(t, `{ "x" : 1.50, "y":[ 2 ,3] }`, string(actual.Data))
+	expectEQString(t, `"A"`, string(*actual.Ptr))
+
+	// ToStruct 没有原始文本，使用 LeptStringify
+	v := NewLeptValue()
+	expectEQLeptEvent(t, LeptParseOK, LeptParse(v, input))
+	fromDOM := &envelope{}
+	if err := ToStruct(v, fromDOM); err != nil {
+		t.Errorf("ToStruct expect no err: %v", err)
+	}
+	expectEQString(t, `{"x":1.5,"y":[2,3]}`, string(fromDOM.Data))
+	expectEQString(t, string(*actual.Ptr), string(*fromDOM.Ptr))
+	data := LeptFindObjectValue(v, "data")
+	LeptSetNumber(LeptGetArrayElement(LeptFindObjectValue(data, "y"), 0), 4)
+	if err := ToStruct(v, fromDOM); err != nil {
+		t.Errorf("ToStruct expect no err: %v", err)
+	}
+	expectEQString(t, `{"x":1.5,"y":[4,3]}`, string(fromDOM.Data))
+	// 保存了原始文本的数字原样写入，字符串重新转义
+	v = NewLeptValue()
+	expectEQLeptEvent(t, LeptParseOK, LeptParse(v, `{"data":{"n":12345678901234567890,"f":1.50,"s":"\u00e9\/"}}`))
+	if err := ToStruct(v, fromDOM); err != nil {
+		t.Errorf("ToStruct expect no err: %v", err)
+	}
+	expectEQString(t, `{"n":12345678901234567890,"f":1.5,"s":"é/"}`, string(fromDOM.Data))
+	v = NewLeptValue()
+	expectEQLeptEvent(t, LeptParseOK, LeptParse(v, `{"data":[1.50,2,1e3]}`, UseNumber()))
+	if err := ToStruct(v, fromDOM); err != nil {
+		t.Errorf("ToStruct expect no err: %v", err)
+	}
+	expectEQString(t, `[1.50,2,1e3]`, string(fromDOM.Data))
+
+	// LeptContext 记录最近解析的值在输入中的位置
+	c := NewLeptContext(input)
+	expectEQLeptEvent(t, LeptParseOK, LeptParseValue(c, NewLeptValue()))
+	start, end := c.Span()
+	expectEQInt(t, 0, start)
+	expectEQInt(t, len(input), end)
+	c = NewLeptContext(`  [1, "a"]`)
+	LeptParseWhitespace(c)
+	expectEQLeptEvent(t, LeptParseOK, LeptParseValue(c, NewLeptValue()))
+	start, end = c.Span()
+	expectEQString(t, `[1, "a"]`, `  [1, "a"]`[start:end])
+
+	// 和 encoding/json 的 json.Unmarshaler 相同的签名
+	var _ json.Unmarshaler = new(RawMessage)
+	var _ json.Marshaler = RawMessage{}
+
+	// Marshal 原样输出
+	buf, err := Marshal(actual)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	expectEQString(t, `{"kind":"point","data":{ "x" : 1.50, "y":[ 2 ,3] },"ptr":"A"}`, string(buf))
+
+	// 延迟解析
+	var point struct {
+		X float64 `json:"x"`
+		Y []int   `json:"y"`
+	}
+	if err := Unmarshal(actual.Data, &point); err != nil {
+		t.Errorf("Unmarshal expect no err: %v", err)
+	}
+	expectEQFloat64(t, 1.5, point.X)
+	expectEQInt(t, 2, len(point.Y))
+
+	// null 对应 "null" 以及 nil 指针，nil RawMessage 输出 null
+	actual = &envelope{}
+	if err := Unmarshal([]byte(`{"data":null,"ptr":null}`), actual); err != nil {
+		t.Errorf("Unmarshal expect no err: %v", err)
+	}
+	expectEQString(t, "null", string(actual.Data))
+	expectEQBool(t, true, actual.Ptr == nil)
+	buf, err = Marshal(envelope{})
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	expectEQString(t, `{"kind":"","data":null,"ptr":null}`, string(buf))
+
+	// Marshal 检查 MarshalJSON 的输出
+	_, err = Marshal(envelope{Data: RawMessage(`{"a":1`)})
+	expectEQString(t, "MarshalJSON of goleptjson.RawMessage returned invalid json: LeptParseMissCommaOrCurlyBracket", fmt.Sprint(err))
+	_, err = Marshal([]interface{}{invalidMarshaler{}})
+	expectEQString(t, "MarshalJSON of goleptjson.invalidMarshaler returned invalid json: LeptParseInvalidValue", fmt.Sprint(err))
+
+	valid := []struct {
+		input  string
+		expect LeptEvent
+	}{
+		{` [1, {"a": "b"}] `, LeptParseOK},
+		{`[1,]`, LeptParseInvalidValue},
+		{`1 2`, LeptParseRootNotSingular},
+		{``, LeptParseExpectValue},
+	}
+	for _, tt := range valid {
+		expectEQLeptEvent(t, tt.expect, LeptValid(tt.input))
+	}
+}
+
+func TestNumber(t *testing.T) {
+	input := `{"big":12345678901234567890,"f":1.50,"list":[1e3,-0],"s":"x"}`
+	var i interface{}
+	if err := Unmarshal([]byte(input), &i, UseNumber()); err != nil {
+		t.Fatalf("Unmarshal expect no err: %v", err)
+	}
+	m := i.(map[string]interface{})
+	expectEQString(t, "12345678901234567890", m["big"].(Number).String())
+	expectEQString(t, "1.50", string(m["f"].(Number)))
+	expectEQString(t, "1e3", string(m["list"].([]interface{})[0].(Number)))
+	expectEQString(t, "x", m["s"].(string))
+	f, err := m["f"].(Number).Float64()
+	if err != nil {
+		t.Errorf("Number Float64 expect no err: %v", err)
+	}
+	expectEQFloat64(t, 1.5, f)
+	if _, err := m["big"].(Number).Int64(); err == nil {
+		t.Errorf("Number Int64 expect overflow err")
+	}
+	n, err := m["list"].([]interface{})[1].(Number).Int64()
+	if err != nil {
+		t.Errorf("Number Int64 expect no err: %v", err)
+	}
+	expectEQInt(t, 0, int(n))
+
+	// 默认仍然是 float64
+	if err := Unmarshal([]byte(input), &i); err != nil {
+		t.Errorf("Unmarshal expect no err: %v", err)
+	}
+	expectEQFloat64(t, 1.5, i.(map[string]interface{})["f"].(float64))
+
+	// LeptParse 使用 UseNumber 时才保存小数的原始文本
+	v := NewLeptValue()
+	expectEQLeptEvent(t, LeptParseOK, LeptParse(v, input, UseNumber()))
+	expectEQString(t, "1.50", string(ToMap(v, UseNumber())["f"].(Number)))
+	expectEQString(t, "1e3", string(ToArray(LeptFindObjectValue(v, "list"), UseNumber())[0].(Number)))
+	expectEQString(t, "12345678901234567890", string(ToInterface(v, UseNumber()).(map[string]interface{})["big"].(Number)))
+	var mi map[string]interface{}
+	if err := ToStruct(v, &mi, UseNumber()); err != nil {
+		t.Errorf("ToStruct expect no err: %v", err)
+	}
+	expectEQString(t, "1.50", string(mi["f"].(Number)))
+	// 没有原始文本的数字使用最短的表示
+	expectEQString(t, "0.1", string(ToInterface(&LeptValue{typ: LeptNumber, n: 0.1}, UseNumber()).(Number)))
+	expectEQString(t, "1000000", string(ToInterface(&LeptValue{typ: LeptNumber, n: 1e6}, UseNumber()).(Number)))
+	// 只保存无法由 float64 还原的文本，超过 2^53 的整数总是保存，LeptCopy 保留原始文本
+	tests := []struct {
+		input  string
+		opts   []Option
+		expect string
+	}{
+		{`[123,-0,1.5,1.50,1e3,12345678901234567890,9007199254740992]`, nil,
+			`,,,,,12345678901234567890,`},
+		{`[123,-0,1.5,1.50,1e3,12345678901234567890,9007199254740992]`, []Option{UseNumber()},
+			`,,,1.50,1e3,12345678901234567890,`},
+	}
+	for _, tt := range tests {
+		v = NewLeptValue()
+		expectEQLeptEvent(t, LeptParseOK, LeptParse(v, tt.input, tt.opts...))
+		var texts []string
+		for _, e := range v.a {
+			texts = append(texts, e.s)
+		}
+		expectEQString(t, tt.expect, strings.Join(texts, ","))
+	}
+	copied := NewLeptValue()
+	LeptCopy(copied, v)
+	expectEQString(t, "[123 -0 1.5 1.50 1e3 12345678901234567890 9007199254740992]", fmt.Sprint(ToArray(copied, UseNumber())))
+	expectEQLeptEvent(t, LeptParseOK, LeptParse(v, `1.50`))
+	expectEQString(t, "1.5", string(ToInterface(v, UseNumber()).(Number)))
+
+	// Number 类型的字段，不需要 UseNumber
+	type numbers struct {
+		Big    Number            `json:"big"`
+		Quoted Number            `json:"quoted"`
+		Map    map[string]Number `json:"map"`
+	}
+	actual := &numbers{}
+	if err := Unmarshal([]byte(`{"big":12345678901234567890,"quoted":"-1.5e-3","map":{"a":0.10}}`), actual); err != nil {
+		t.Errorf("Unmarshal expect no err: %v", err)
+	}
+	expectEQString(t, "12345678901234567890", string(actual.Big))
+	expectEQString(t, "-1.5e-3", string(actual.Quoted))
+	expectEQString(t, "0.10", string(actual.Map["a"]))
+	err = Unmarshal([]byte(`{"quoted":"abc"}`), actual)
+	expectEQString(t, `v LeptValue string "abc" is not a valid number`, fmt.Sprint(err))
+
+	buf, err := Marshal(actual)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	expectEQString(t, `{"big":12345678901234567890,"quoted":-1.5e-3,"map":{"a":0.10}}`, string(buf))
+	buf, err = Marshal(numbers{})
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	expectEQString(t, `{"big":0,"quoted":0,"map":null}`, string(buf))
+	_, err = Marshal(Number("01"))
+	expectEQString(t, `invalid number literal "01"`, fmt.Sprint(err))
+
+	fv, err := FromInterface(numbers{Big: "12345678901234567890", Quoted: "2"})
+	if err != nil {
+		t.Errorf("FromInterface expect no err: %v", err)
+	}
+	expectEQLeptType(t, LeptNumber, LeptGetType(LeptFindObjectValue(fv, "big")))
+	expectEQFloat64(t, 2, LeptGetNumber(LeptFindObjectValue(fv, "quoted")))
+}
+
+func TestEscapeModes(t *testing.T) {
+	tests := []struct {
+		input, expect, html, ascii string
+	}{
+		{"abc", `"abc"`, `"abc"`, `"abc"`},
+		{"<a href='x'>&</a>", `"<a href='x'>&</a>"`, `"\u003ca href='x'\u003e\u0026\u003c/a\u003e"`, `"<a href='x'>&</a>"`},
+		{"line\u2028para\u2029", "\"line\u2028para\u2029\"", `"line\u2028para\u2029"`, `"line\u2028para\u2029"`},
+		{"中文", `"中文"`, `"中文"`, `"\u4e2d\u6587"`},
+		{"é😀", `"é😀"`, `"é😀"`, `"\u00e9\ud83d\ude00"`},
+		{"\x01\"\\", `"\u0001\"\\"`, `"\u0001\"\\"`, `"\u0001\"\\"`},
+		{"bad\xff", "\"bad\xff\"", "\"bad\xff\"", `"bad\ufffd"`},
+	}
+	for _, tt := range tests {
+		v := NewLeptValue()
+		LeptSetString(v, tt.input)
+		expectEQString(t, tt.expect, LeptStringify(v))
+		expectEQString(t, tt.html, LeptStringify(v, EscapeHTML()))
+		expectEQString(t, tt.ascii, LeptStringify(v, EscapeASCII()))
+		if utf8.ValidString(tt.input) {
+			for _, s := range []string{tt.html, tt.ascii} {
+				back := NewLeptValue()
+				expectEQLeptEvent(t, LeptParseOK, LeptParse(back, s))
+				expectEQString(t, tt.input, LeptGetString(back))
+			}
+		}
+	}
+
+	// Marshal 的字段名，map 的 key，TextMarshaler 以及 MarshalJSON 的输出都需要转义
+	type escaped struct {
+		Text  string            `json:"<text>"`
+		Map   map[string]string `json:"map"`
+		Color textColor         `json:"color"`
+		Raw   RawMessage        `json:"raw"`
+		Str   string            `json:"str,string"`
+	}
+	input := escaped{
+		Text:  "<b>粗体</b>",
+		Map:   map[string]string{"键&": "值"},
+		Color: textGreen,
+		Raw:   RawMessage(`{"k": "<原样>"}`),
+		Str:   "<😀>",
+	}
+	buf, err := Marshal(input, EscapeHTML())
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	ebuf, err := json.Marshal(struct {
+		Text  string            `json:"<text>"`
+		Map   map[string]string `json:"map"`
+		Color textColor         `json:"color"`
+		Raw   json.RawMessage   `json:"raw"`
+		Str   string            `json:"str,string"`
+	}{input.Text, input.Map, input.Color, json.RawMessage(input.Raw), input.Str})
+	if err != nil {
+		t.Errorf("json.Marshal expect no err: %v", err)
+	}
+	// encoding/json 会压缩 RawMessage 中的空白
+	expectEQString(t, strings.Replace(string(ebuf), `{"k":`, `{"k": `, 1), string(buf))
+
+	buf, err = Marshal(input, EscapeASCII())
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	for _, c := range buf {
+		if c >= utf8.RuneSelf {
+			t.Errorf("Marshal EscapeASCII expect ascii only, actual: %s", buf)
+			break
+		}
+	}
+	actual := escaped{}
+	if err := Unmarshal(buf, &actual); err != nil {
+		t.Errorf("Unmarshal expect no err: %v", err)
+	}
+	expectEQString(t, input.Text, actual.Text)
+	expectEQString(t, input.Map["键&"], actual.Map["键&"])
+	expectEQString(t, input.Str, actual.Str)
+	expectEQString(t, `{"k": "<\u539f\u6837>"}`, string(actual.Raw))
+	expectEQString(t, `{"k": "\u003c\u539f\u6837\u003e"}`,
+		string(mustMarshal(t, RawMessage(`{"k": "<原样>"}`), EscapeHTML(), EscapeASCII())))
+}
+
+func mustMarshal(t *testing.T, x interface{}, opts ...Option) []byte {
+	buf, err := Marshal(x, opts...)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	return buf
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	input := "[\"a\xffb\xc3\",\"ok\",\"\\u00e9\xe9\"]"
+	tests := []struct {
+		policy UTF8Policy
+		event  LeptEvent
+		expect []string
+	}{
+		{UTF8PassThrough, LeptParseOK, []string{"a\xffb\xc3", "ok", "é\xe9"}},
+		{UTF8Replace, LeptParseOK, []string{"a\ufffdb\ufffd", "ok", "é\ufffd"}},
+		{UTF8Reject, LeptParseInvalidUTF8, nil},
+	}
+	for _, tt := range tests {
+		v := NewLeptValue()
+		expectEQLeptEvent(t, tt.event, LeptParse(v, input, InvalidUTF8(tt.policy)))
+		var actual []string
+		err := Unmarshal([]byte(input), &actual, InvalidUTF8(tt.policy))
+		if tt.event != LeptParseOK {
+			expectEQString(t, "Unmarshal parse error: LeptParseInvalidUTF8", fmt.Sprint(err))
+			continue
+		}
+		for i, s := range tt.expect {
+			expectEQString(t, s, LeptGetString(LeptGetArrayElement(v, i)))
+			expectEQString(t, s, actual[i])
+		}
+	}
+	// object 的 key 以及跳过的字段同样检查
+	var s struct{}
+	err := Unmarshal([]byte("{\"k\xff\":1}"), &s, InvalidUTF8(UTF8Reject))
+	expectEQString(t, "Unmarshal parse error: LeptParseInvalidUTF8", fmt.Sprint(err))
+
+	// 输出
+	v := NewLeptValue()
+	LeptSetString(v, "a\xffé")
+	expectEQString(t, "\"a\xffé\"", LeptStringify(v))
+	expectEQString(t, `"a\ufffdé"`, LeptStringify(v, InvalidUTF8(UTF8Replace)))
+	expectEQString(t, `"a\ufffd\u00e9"`, LeptStringify(v, EscapeASCII()))
+	// LeptStringify 不返回错误，UTF8Reject 按照 UTF8Replace 处理
+	expectEQString(t, `"a\ufffdé"`, LeptStringify(v, InvalidUTF8(UTF8Reject)))
+	_, err = LeptMarshal(v, InvalidUTF8(UTF8Reject))
+	expectEQString(t, `invalid UTF-8 in string: "a\xffé"`, fmt.Sprint(err))
+	_, err = LeptMarshal(mustParse(t, "{\"k\xff\":1}"), InvalidUTF8(UTF8Reject))
+	expectEQString(t, `invalid UTF-8 in string: "k\xff"`, fmt.Sprint(err))
+
+	type text struct {
+		S   string     `json:"s"`
+		Raw RawMessage `json:"raw"`
+	}
+	x := text{S: "a\xff", Raw: RawMessage("\"b\xfe\"")}
+	expectEQString(t, "{\"s\":\"a\xff\",\"raw\":\"b\xfe\"}", string(mustMarshal(t, x)))
+	expectEQString(t, `{"s":"a\ufffd","raw":"b\ufffd"}`, string(mustMarshal(t, x, InvalidUTF8(UTF8Replace))))
+	_, err = Marshal(x, InvalidUTF8(UTF8Reject))
+	expectEQString(t, `invalid UTF-8 in string: "a\xff"`, fmt.Sprint(err))
+	_, err = Marshal(text{Raw: x.Raw}, InvalidUTF8(UTF8Reject))
+	expectEQString(t, `invalid UTF-8 in string: "\"b\xfe\""`, fmt.Sprint(err))
+}
+
+func TestNonFinite(t *testing.T) {
+	type floats struct {
+		N   float64 `json:"n"`
+		P   float32 `json:"p"`
+		M   float64 `json:"m"`
+		Str float64 `json:"str,string"`
+	}
+	x := floats{N: math.NaN(), P: float32(math.Inf(1)), M: math.Inf(-1), Str: math.NaN()}
+	_, err := Marshal(x)
+	expectEQString(t, "unsupported value: NaN", fmt.Sprint(err))
+	uerr, ok := err.(*UnsupportedValueError)
+	expectEQBool(t, true, ok)
+	expectEQBool(t, true, math.IsNaN(uerr.Value.Float()))
+	_, err = Marshal(float32(math.Inf(-1)))
+	expectEQString(t, "unsupported value: -Inf", fmt.Sprint(err))
+	expectEQString(t, `{"n":null,"p":null,"m":null,"str":null}`, string(mustMarshal(t, x, NonFinite(NonFiniteNull))))
+	expectEQString(t, `{"n":NaN,"p":Infinity,"m":-Infinity,"str":NaN}`, string(mustMarshal(t, x, NonFinite(NonFiniteJSON5))))
+
+	v := mustParse(t, `[1,2]`)
+	LeptSetNumber(LeptGetArrayElement(v, 1), math.Inf(1))
+	b, err := LeptMarshal(v)
+	expectEQString(t, "unsupported value: +Inf", fmt.Sprint(err))
+	expectEQBool(t, true, b == nil)
+	b, err = LeptMarshal(v, NonFinite(NonFiniteNull))
+	expectEQString(t, "<nil>", fmt.Sprint(err))
+	expectEQString(t, "[1,null]", string(b))
+	expectEQString(t, "[1,Infinity]", LeptStringify(v, NonFinite(NonFiniteJSON5)))
+	// LeptStringify 不会失败，默认写成 null
+	expectEQString(t, "[1,null]", LeptStringify(v))
+
+	// LeptValue 以及 *LeptValue 同样返回错误，而不是输出非法的 json，并且使用 Marshal 的 opts
+	_, err = Marshal(struct{ V *LeptValue }{v})
+	expectEQString(t, "unsupported value: +Inf", fmt.Sprint(err))
+	expectEQString(t, `{"V":[1,null]}`, string(mustMarshal(t, struct{ V *LeptValue }{v}, NonFinite(NonFiniteNull))))
+	expectEQString(t, `[1,null]`, string(mustMarshal(t, v, NonFinite(NonFiniteNull))))
+	expectEQString(t, `{"V":null}`, string(mustMarshal(t, struct{ V *LeptValue }{})))
+	expectEQString(t, `["\u00e9"]`, string(mustMarshal(t, []*LeptValue{mustParse(t, `"é"`)}, EscapeASCII())))
+	_, err = json.Marshal(v)
+	expectEQBool(t, true, err != nil)
+	_, err = Marshal(*v)
+	expectEQString(t, "unsupported value: +Inf", fmt.Sprint(err))
+}
+
+type cycleNode struct {
+	Name     string       `json:"name"`
+	Parent   *cycleNode   `json:"parent,omitempty"`
+	Children []*cycleNode `json:"children,omitempty"`
+}
+
+type firstField struct {
+	Inner cycleNode  `json:"inner"`
+	Ptr   *cycleNode `json:"ptr"`
+}
+
+func TestMarshalCycle(t *testing.T) {
+	root := &cycleNode{Name: "root"}
+	child := &cycleNode{Name: "child", Parent: root}
+	root.Children = []*cycleNode{child}
+	_, err := Marshal(root)
+	expectEQString(t, "unsupported value: encountered a cycle via []*goleptjson.cycleNode", fmt.Sprint(err))
+	_, ok := err.(*UnsupportedValueError)
+	expectEQBool(t, true, ok)
+
+	m := map[string]interface{}{}
+	m["self"] = m
+	_, err = Marshal(m)
+	expectEQString(t, "unsupported value: encountered a cycle via map[string]interface {}", fmt.Sprint(err))
+
+	s := []interface{}{nil}
+	s[0] = s
+	_, err = Marshal(s)
+	expectEQString(t, "unsupported value: encountered a cycle via []interface {}", fmt.Sprint(err))
+
+	// 很深但是没有环的数据，以及在不同的分支中重复出现的指针，都可以正常输出
+	head := &cycleNode{Name: "0"}
+	for i, n := 1, head; i < 2*startDetectingCyclesAfter; i++ {
+		n.Children = []*cycleNode{{Name: strconv.Itoa(i)}}
+		n = n.Children[0]
+	}
+	b, err := Marshal(head)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	expectEQBool(t, true, json.Valid(b))
+	tail := head
+	for tail.Children != nil {
+		tail = tail.Children[0]
+	}
+	shared := &cycleNode{Name: "shared"}
+	tail.Children = []*cycleNode{shared, shared}
+	b, err = Marshal(head)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	expectEQBool(t, true, strings.Contains(string(b), `[{"name":"shared"},{"name":"shared"}]`))
+
+	// 指向 struct 第一个字段的指针和 struct 的地址相同，但不是环
+	ff := &firstField{}
+	ff.Ptr = &ff.Inner
+	var deep interface{} = ff
+	for i := 0; i < startDetectingCyclesAfter; i++ {
+		deep = []interface{}{deep}
+	}
+	b, err = Marshal(deep)
+	if err != nil {
+		t.Errorf("Marshal expect no err: %v", err)
+	}
+	expectEQBool(t, true, strings.Contains(string(b), `[{"inner":{"name":""},"ptr":{"name":""}}]`))
+}
+
+type namingUser struct {
+	UserID    int    `json:",omitempty"`
+	FirstName string `json:"given"`
+	HTTPProxy string
+	Address2  string
+	Skip      string `json:"-"`
+}
+
+func TestNamingStrategy(t *testing.T) {
+	names := []struct {
+		name                                     string
+		lowerCamel, snake, kebab, screamingSnake string
+	}{
+		{"Name", "name", "name", "name", "NAME"},
+		{"UserID", "userID", "user_id", "user-id", "USER_ID"},
+		{"HTTPServer", "httpServer", "http_server", "http-server", "HTTP_SERVER"},
+		{"XMLHttpRequest2", "xmlHttpRequest2", "xml_http_request2", "xml-http-request2", "XML_HTTP_REQUEST2"},
+		{"ID", "id", "id", "id", "ID"},
+		{"Address2Line", "address2Line", "address2_line", "address2-line", "ADDRESS2_LINE"},
+		{"Already_Snake", "alreadySnake", "already_snake", "already-snake", "ALREADY_SNAKE"},
+		{"ÜberName", "überName", "über_name", "über-name", "ÜBER_NAME"},
+	}
+	for _, tt := range names {
+		expectEQString(t, tt.name, IdentityNaming(tt.name))
+		expectEQString(t, tt.lowerCamel, LowerCamelCase(tt.name))
+		expectEQString(t, tt.snake, SnakeCase(tt.name))
+		expectEQString(t, tt.kebab, KebabCase(tt.name))
+		expectEQString(t, tt.screamingSnake, ScreamingSnakeCase(tt.name))
+	}
+
+	x := namingUser{UserID: 7, FirstName: "a", HTTPProxy: "p", Address2: "b", Skip: "s"}
+	tests := []struct {
+		strategy NamingStrategy
+		expect   string
+	}{
+		{nil, `{"UserID":7,"given":"a","HTTPProxy":"p","Address2":"b"}`},
+		{IdentityNaming, `{"UserID":7,"given":"a","HTTPProxy":"p","Address2":"b"}`},
+		{LowerCamelCase, `{"userID":7,"given":"a","httpProxy":"p","address2":"b"}`},
+		{SnakeCase, `{"user_id":7,"given":"a","http_proxy":"p","address2":"b"}`},
+		{KebabCase, `{"user-id":7,"given":"a","http-proxy":"p","address2":"b"}`},
+		{ScreamingSnakeCase, `{"USER_ID":7,"given":"a","HTTP_PROXY":"p","ADDRESS2":"b"}`},
+		{strings.ToLower, `{"userid":7,"given":"a","httpproxy":"p","address2":"b"}`},
+	}
+	for _, tt := range tests {
+		b := mustMarshal(t, x, FieldNaming(tt.strategy))
+		expectEQString(t, tt.expect, string(b))
+		// Unmarshal 以及 ToStruct 使用同样的名字
+		var actual namingUser
+		if err := Unmarshal(b, &actual, FieldNaming(tt.strategy)); err != nil {
+			t.Errorf("Unmarshal expect no err: %v", err)
+		}
+		expectEQString(t, fmt.Sprint(namingUser{UserID: 7, FirstName: "a", HTTPProxy: "p", Address2: "b"}), fmt.Sprint(actual))
+		actual = namingUser{}
+		if err := ToStruct(mustParse(t, string(b)), &actual, FieldNaming(tt.strategy)); err != nil {
+			t.Errorf("ToStruct expect no err: %v", err)
+		}
+		expectEQString(t, fmt.Sprint(namingUser{UserID: 7, FirstName: "a", HTTPProxy: "p", Address2: "b"}), fmt.Sprint(actual))
+	}
+	// 不设置 NamingStrategy 时使用缓存的字段，不受之前设置的影响
+	expectEQString(t, tests[0].expect, string(mustMarshal(t, x)))
+	// 内置的 NamingStrategy 转换之后的字段按照类型全局缓存，不同的 options 共享
+	typ := reflect.TypeOf(x)
+	snake := newOptions([]Option{FieldNaming(SnakeCase)}).typeFields(typ)
+	expectEQBool(t, true, snake == newOptions([]Option{FieldNaming(SnakeCase)}).typeFields(typ))
+	expectEQBool(t, false, snake == newOptions([]Option{FieldNaming(KebabCase)}).typeFields(typ))
+	// 同一个函数字面量得到的闭包函数地址相同，只在同一个 options 中缓存
+	prefix := func(p string) NamingStrategy {
+		return func(n string) string { return p + n }
+	}
+	type point struct{ X, Y int }
+	expectEQString(t, `{"aX":1,"aY":2}`, string(mustMarshal(t, point{1, 2}, FieldNaming(prefix("a")))))
+	expectEQString(t, `{"bX":1,"bY":2}`, string(mustMarshal(t, point{1, 2}, FieldNaming(prefix("b")))))
+	var p point
+	if err := Unmarshal([]byte(`{"cX":3,"aY":4}`), &p, FieldNaming(prefix("c"))); err != nil {
+		t.Errorf("Unmarshal expect no err: %v", err)
+	}
+	expectEQString(t, "{3 0}", fmt.Sprint(p))
+	custom := newOptions([]Option{FieldNaming(prefix("a"))})
+	expectEQBool(t, true, custom.typeFields(typ) == custom.typeFields(typ))
+	expectEQBool(t, false, custom.typeFields(typ) == newOptions([]Option{FieldNaming(prefix("a"))}).typeFields(typ))
+	FieldNaming(prefix("b"))(custom)
+	expectEQString(t, "bUserID", custom.typeFields(typ).list[0].name)
+	var actual namingUser
+	err := Unmarshal([]byte(`{"user_id":1,"UserID":2}`), &actual, FieldNaming(SnakeCase), DisallowUnknownFields())
+	expectEQString(t, `unknown field "UserID"`, fmt.Sprint(err))
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetNamingStrategy(KebabCase)
+	enc.Encode(x)
+	enc.Encode([]namingUser{{UserID: 1}})
+	expectEQString(t, "{\"user-id\":7,\"given\":\"a\",\"http-proxy\":\"p\",\"address2\":\"b\"}\n"+
+		"[{\"user-id\":1,\"given\":\"\",\"http-proxy\":\"\",\"address2\":\"\"}]\n", buf.String())
+	dec := NewDecoder(&buf)
+	dec.SetNamingStrategy(KebabCase)
+	actual = namingUser{}
+	if err := dec.Decode(&actual); err != nil {
+		t.Errorf("Decode expect no err: %v", err)
+	}
+	expectEQInt(t, 7, actual.UserID)
+	expectEQString(t, "p", actual.HTTPProxy)
+	// Encoder Decoder 在多次调用之间缓存自定义 naming 的字段，修改 naming 之后重新转换
+	buf.Reset()
+	enc = NewEncoder(&buf)
+	enc.SetNamingStrategy(prefix("a"))
+	enc.Encode(point{1, 2})
+	enc.SetNamingStrategy(prefix("b"))
+	enc.Encode(point{3, 4})
+	expectEQString(t, "{\"aX\":1,\"aY\":2}\n{\"bX\":3,\"bY\":4}\n", buf.String())
+	dec = NewDecoder(&buf)
+	dec.SetNamingStrategy(prefix("a"))
+	p = point{}
+	dec.Decode(&p)
+	dec.SetNamingStrategy(prefix("b"))
+	dec.Decode(&p)
+	expectEQString(t, "{3 4}", fmt.Sprint(p))
+}
+
+type defaultServer struct {
+	Host   string         `json:"host" default:"localhost"`
+	Port   int            `json:"port" default:"8080"`
+	Quoted string         `json:"quoted" default:"\"8080\""`
+	Tags   []string       `json:"tags" default:"[\"a\",\"b\"]"`
+	Limits map[string]int `json:"limits" default:"{\"cpu\":2}"`
+	Debug  *bool          `json:"debug" default:"true"`
+}
+
+type defaultConfig struct {
+	Name    string         `json:"name" default:"app"`
+	Server  defaultServer  `json:"server"`
+	Backup  defaultServer  `json:"backup" default:"{\"host\":\"backup\",\"port\":9090}"`
+	Replica *defaultServer `json:"replica"`
+}
+
+func TestDefaultTag(t *testing.T) {
+	const (
+		server = `{"host":"localhost","port":8080,"quoted":"8080","tags":["a","b"],"limits":{"cpu":2},"debug":true}`
+		backup = `{"host":"backup","port":9090,"quoted":"8080","tags":["a","b"],"limits":{"cpu":2},"debug":true}`
+	)
+	tests := []struct {
+		input  string
+		opts   []Option
+		expect string
+	}{
+		// key 不存在时使用 default，嵌套的 struct 同样使用自己的 default
+		{`{}`, nil, `{"name":"app","server":` + server + `,"backup":` + backup + `,"replica":` + server + `}`},
+		{`{"name":"x","server":{"port":1,"debug":false},"backup":{},"replica":{"host":"r"}}`, nil,
+			`{"name":"x","server":{"host":"localhost","port":1,"quoted":"8080","tags":["a","b"],"limits":{"cpu":2},"debug":false},"backup":` + server +
+				`,"replica":{"host":"r","port":8080,"quoted":"8080","tags":["a","b"],"limits":{"cpu":2},"debug":true}}`},
+		// null 默认仍然是 null，DefaultOnNull 时和 key 不存在一样
+		{`{"server":{"tags":null,"limits":null,"debug":null},"replica":null}`, nil,
+			`{"name":"app","server":{"host":"localhost","port":8080,"quoted":"8080","tags":null,"limits":null,"debug":null},"backup":` + backup + `,"replica":null}`},
+		{`{"name":null,"server":{"host":null,"tags":null,"limits":null,"debug":null},"replica":null}`, []Option{DefaultOnNull()},
+			`{"name":"app","server":` + server + `,"backup":` + backup + `,"replica":null}`},
+	}
+	for _, tt := range tests {
+		// 单次解析的 Unmarshal 和先解析为 LeptValue 的 ToStruct 结果一致
+		var actual defaultConfig
+		if err := Unmarshal([]byte(tt.input), &actual, tt.opts...); err != nil {
+			t.Errorf("Unmarshal expect no err: %v", err)
+		}
+		expectEQString(t, tt.expect, string(mustMarshal(t, actual)))
+		actual = defaultConfig{}
+		if err := ToStruct(mustParse(t, tt.input), &actual, tt.opts...); err != nil {
+			t.Errorf("ToStruct expect no err: %v", err)
+		}
+		expectEQString(t, tt.expect, string(mustMarshal(t, actual)))
+	}
+
+	// 每次解析得到的 slice map 互不影响
+	var a, b defaultServer
+	Unmarshal([]byte(`{}`), &a)
+	Unmarshal([]byte(`{}`), &b)
+	a.Tags[0] = "changed"
+	a.Limits["cpu"] = 4
+	expectEQString(t, "a", b.Tags[0])
+	expectEQInt(t, 2, b.Limits["cpu"])
+
+	// Unmarshaler 得到的是 default 的副本，不会修改缓存中的值
+	f := cachedTypeFields(reflect.TypeOf(defaultServer{})).list[3]
+	dv := f.newDefault()
+	expectEQBool(t, false, dv == f.defaultValue)
+	expectEQBool(t, true, LeptIsEqual(dv, f.defaultValue))
+	LeptSetString(LeptGetArrayElement(dv, 0), "changed")
+	expectEQString(t, `["a","b"]`, LeptStringify(f.defaultValue))
+
+	// default 和字段的类型不一致时返回错误
+	var mismatch struct {
+		N int `json:"n" default:"\"abc\""`
+	}
+	err := Unmarshal([]byte(`{}`), &mismatch)
+	expectEQString(t, "v LeptValue is not a number: LeptString", fmt.Sprint(err))
+
+	// 只有 string 类型的字段可以省略引号，其余类型的 default 不是合法的 json 时返回错误，key 存在时同样返回
+	var ptr struct {
+		S *string `json:"s" default:"abc"`
+	}
+	if err := Unmarshal([]byte(`{}`), &ptr); err != nil {
+		t.Errorf("Unmarshal expect no err: %v", err)
+	}
+	expectEQString(t, "abc", *ptr.S)
+	var bad struct {
+		N int `json:"n" default:"abc"`
+	}
+	for _, input := range []string{`{}`, `{"n":1}`} {
+		err = Unmarshal([]byte(input), &bad)
+		expectEQString(t, "invalid default tag of field N: LeptParseInvalidValue", fmt.Sprint(err))
+		err = ToStruct(mustParse(t, input), &bad)
+		expectEQString(t, "invalid default tag of field N: LeptParseInvalidValue", fmt.Sprint(err))
+	}
+	err = Unmarshal([]byte(`{}`), &bad, FieldNaming(SnakeCase))
+	expectEQString(t, "invalid default tag of field N: LeptParseInvalidValue", fmt.Sprint(err))
+}
+
+type zeroPoint struct {
+	X int `json:"x,omitzero"`
+	Y int `json:"y,omitzero"`
+}
+
+// zeroDate 的 IsZero 和零值不同，year 不大于 0 都视为零值
+type zeroDate struct {
+	Year int `json:"year"`
+}
+
+func (d zeroDate) IsZero() bool {
+	return d.Year <= 0
+}
+
+// zeroCounter 的 IsZero 是指针方法
+type zeroCounter struct {
+	N int `json:"n"`
+}
+
+func (c *zeroCounter) IsZero() bool {
+	return c.N == 0
+}
+
+type omitZeroStruct struct {
+	Time    time.Time                  `json:"time,omitzero"`
+	Point   zeroPoint                  `json:"point,omitzero"`
+	Arr     [2]int                     `json:"arr,omitzero"`
+	Slice   []int                      `json:"slice,omitzero"`
+	Map     map[string]int             `json:"map,omitzero"`
+	Ptr     *zeroPoint                 `json:"ptr,omitzero"`
+	Date    zeroDate                   `json:"date,omitzero"`
+	DatePtr *zeroDate                  `json:"date_ptr,omitzero"`
+	Counter zeroCounter                `json:"counter,omitzero"`
+	Zeroer  interface{ IsZero() bool } `json:"zeroer,omitzero"`
+	Iface   interface{}                `json:"iface,omitzero"`
+	Both    string                     `json:"both,omitempty,omitzero"`
+	Nested  struct {
+		Inner zeroPoint `json:"inner,omitzero"`
+	} `json:"nested,omitzero"`
+}
+
+func TestOmitZero(t *testing.T) {
+	var nilDate *zeroDate
+	tests := []struct {
+		x      omitZeroStruct
+		expect string
+	}{
+		{omitZeroStruct{}, `{}`},
+		{omitZeroStruct{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}, `{"time":"2024-01-02T03:04:05Z"}`},
+		// 和 omitempty 不同，非零的 struct array 以及非 nil 的空 slice map 不省略
+		{omitZeroStruct{Point: zeroPoint{Y: 1}}, `{"point":{"y":1}}`},
+		{omitZeroStruct{Arr: [2]int{0, 1}}, `{"arr":[0,1]}`},
+		{omitZeroStruct{Slice: []int{}, Map: map[string]int{}}, `{"slice":[],"map":{}}`},
+		{omitZeroStruct{Ptr: &zeroPoint{}}, `{"ptr":{}}`},
+		// IsZero 方法优先于零值的判断
+		{omitZeroStruct{Date: zeroDate{Year: -1}}, `{}`},
+		{omitZeroStruct{Date: zeroDate{Year: 2024}}, `{"date":{"year":2024}}`},
+		{omitZeroStruct{DatePtr: &zeroDate{}}, `{}`},
+		{omitZeroStruct{DatePtr: &zeroDate{Year: 1}}, `{"date_ptr":{"year":1}}`},
+		{omitZeroStruct{Counter: zeroCounter{}}, `{}`},
+		{omitZeroStruct{Counter: zeroCounter{N: 1}}, `{"counter":{"n":1}}`},
+		// nil 接口和包含 nil 指针的接口都视为零值
+		{omitZeroStruct{Zeroer: nilDate}, `{}`},
+		{omitZeroStruct{Zeroer: zeroDate{}}, `{}`},
+		{omitZeroStruct{Zeroer: zeroDate{Year: 1}}, `{"zeroer":{"year":1}}`},
+		{omitZeroStruct{Iface: 0}, `{"iface":0}`},
+		{omitZeroStruct{Both: "a"}, `{"both":"a"}`},
+		{omitZeroStruct{Nested: struct {
+			Inner zeroPoint `json:"inner,omitzero"`
+		}{Inner: zeroPoint{X: 1}}}, `{"nested":{"inner":{"x":1}}}`},
+	}
+	for _, tt := range tests {
+		expectEQString(t, tt.expect, string(mustMarshal(t, tt.x)))
+		// 可以取得地址时直接调用指针方法
+		expectEQString(t, tt.expect, string(mustMarshal(t, &tt.x)))
+		v, err := FromStruct(tt.x)
+		if err != nil {
+			t.Errorf("FromStruct expect no err: %v", err)
+		}
+		expectEQString(t, tt.expect, LeptStringify(v))
+	}
+
+	// omitempty 和 omitzero 同时存在时满足任意一个就省略
+	both := []struct {
+		A []int `json:"a,omitempty,omitzero"`
+	}{{}, {A: []int{}}, {A: []int{1}}}
+	expectEQString(t, `[{},{},{"a":[1]}]`, string(mustMarshal(t, both)))
+}
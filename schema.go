@@ -0,0 +1,713 @@
+package goleptjson
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema 是编译之后的 JSON Schema (draft 2020-12)，编译之后只读，可以在多个 goroutine 中使用
+type Schema struct {
+	root *schemaNode
+}
+
+// SchemaOutput 是 Schema.Validate 的结果，对应 JSON Schema 规定的 basic 输出格式，
+// 可以直接使用 Marshal 输出
+type SchemaOutput struct {
+	Valid  bool          `json:"valid"`
+	Errors []SchemaError `json:"errors,omitempty"`
+}
+
+// SchemaError 是 basic 输出格式中的一个输出单元
+// KeywordLocation 是经过 $ref 的求值路径，InstanceLocation 是文档中的位置，都使用 JSON Pointer 表示
+type SchemaError struct {
+	KeywordLocation  string `json:"keywordLocation"`
+	InstanceLocation string `json:"instanceLocation"`
+	Message          string `json:"error"`
+}
+
+func (e SchemaError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", e.InstanceLocation, e.Message, e.KeywordLocation)
+}
+
+// schemaNode 是一个编译之后的 schema，没有出现的关键字使用 nil 或者 -1 表示
+type schemaNode struct {
+	boolean *bool // true false 形式的 schema
+
+	ref   *schemaNode
+	types []string
+	enum  []*LeptValue
+	cnst  *LeptValue
+
+	minimum, maximum                   *float64
+	exclusiveMinimum, exclusiveMaximum *float64
+	multipleOf                         *float64
+	multipleOfRat                      *big.Rat // multipleOf 的十进制精确值，避免浮点除法的误差
+
+	minLength, maxLength int
+	pattern              *regexp.Regexp
+
+	prefixItems              []*schemaNode
+	items                    *schemaNode
+	contains                 *schemaNode
+	minContains, maxContains int
+	minItems, maxItems       int
+	uniqueItems              bool
+
+	properties           map[string]*schemaNode
+	patternProperties    []schemaPattern
+	additionalProperties *schemaNode
+	propertyNames        *schemaNode
+	required             []string
+	dependentRequired    []schemaDependency
+	dependentSchemas     map[string]*schemaNode
+	minProperties        int
+	maxProperties        int
+
+	allOf, anyOf, oneOf []*schemaNode
+	not                 *schemaNode
+	ifs, then, els      *schemaNode
+}
+
+type schemaPattern struct {
+	source string
+	re     *regexp.Regexp
+	node   *schemaNode
+}
+
+type schemaDependency struct {
+	key      string
+	required []string
+}
+
+// LeptCompileSchema 编译 draft 2020-12 的 schema，支持的关键字：
+// type enum const，minimum maximum exclusiveMinimum exclusiveMaximum multipleOf，
+// minLength maxLength pattern，prefixItems items contains minContains maxContains minItems maxItems uniqueItems，
+// properties patternProperties additionalProperties propertyNames required dependentRequired dependentSchemas
+// minProperties maxProperties，allOf anyOf oneOf not if then else，以及指向同一个文档的 $ref (例如 #/$defs/name)。
+// 其余的关键字 (format title 等) 作为注释忽略，pattern 使用 Go 的 regexp 语法
+func LeptCompileSchema(schema *LeptValue) (*Schema, error) {
+	c := &schemaCompiler{root: schema, nodes: make(map[string]*schemaNode)}
+	root, err := c.compile(schema, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkCycles(); err != nil {
+		return nil, err
+	}
+	return &Schema{root: root}, nil
+}
+
+type schemaCompiler struct {
+	root  *LeptValue
+	nodes map[string]*schemaNode // JSON Pointer 对应的 schema，$ref 可以指向正在编译的 schema
+}
+
+func schemaErrorf(ptr, format string, args ...interface{}) error {
+	return fmt.Errorf("invalid schema at #%s: %s", ptr, fmt.Sprintf(format, args...))
+}
+
+// compile 编译 root 中位于 ptr 的 schema v
+func (c *schemaCompiler) compile(v *LeptValue, ptr string) (*schemaNode, error) {
+	if n, ok := c.nodes[ptr]; ok {
+		return n, nil
+	}
+	n := &schemaNode{minLength: -1, maxLength: -1, minContains: -1, maxContains: -1,
+		minItems: -1, maxItems: -1, minProperties: -1, maxProperties: -1}
+	c.nodes[ptr] = n
+	switch v.typ {
+	case LeptTrue, LeptFalse:
+		b := v.typ == LeptTrue
+		n.boolean = &b
+		return n, nil
+	case LeptObject:
+	default:
+		return nil, schemaErrorf(ptr, "schema must be an object or a boolean")
+	}
+	for _, m := range v.o {
+		if err := c.keyword(n, m.key, m.value, ptr+"/"+escapePointer(m.key)); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// keyword 编译 schema 中的一个关键字，kptr 是这个关键字的 JSON Pointer
+func (c *schemaCompiler) keyword(n *schemaNode, key string, v *LeptValue, kptr string) error {
+	var err error
+	switch key {
+	case "$ref":
+		if v.typ != LeptString {
+			return schemaErrorf(kptr, "$ref must be a string")
+		}
+		n.ref, err = c.resolve(v.s, kptr)
+	case "$defs":
+		if v.typ != LeptObject {
+			return schemaErrorf(kptr, "$defs must be an object")
+		}
+		// 没有被引用的定义同样检查
+		for _, m := range v.o {
+			if _, err = c.compile(m.value, kptr+"/"+escapePointer(m.key)); err != nil {
+				return err
+			}
+		}
+	case "type":
+		switch v.typ {
+		case LeptString:
+			n.types = []string{v.s}
+		case LeptArray:
+			for _, t := range v.a {
+				if t.typ != LeptString {
+					return schemaErrorf(kptr, "type must be a string or an array of strings")
+				}
+				n.types = append(n.types, t.s)
+			}
+		default:
+			return schemaErrorf(kptr, "type must be a string or an array of strings")
+		}
+		for _, t := range n.types {
+			switch t {
+			case "null", "boolean", "object", "array", "number", "string", "integer":
+			default:
+				return schemaErrorf(kptr, "unknown type %q", t)
+			}
+		}
+	case "enum":
+		if v.typ != LeptArray {
+			return schemaErrorf(kptr, "enum must be an array")
+		}
+		n.enum = v.a
+	case "const":
+		n.cnst = v
+	case "minimum":
+		n.minimum, err = schemaNumber(v, kptr)
+	case "maximum":
+		n.maximum, err = schemaNumber(v, kptr)
+	case "exclusiveMinimum":
+		n.exclusiveMinimum, err = schemaNumber(v, kptr)
+	case "exclusiveMaximum":
+		n.exclusiveMaximum, err = schemaNumber(v, kptr)
+	case "multipleOf":
+		if n.multipleOf, err = schemaNumber(v, kptr); err == nil && *n.multipleOf <= 0 {
+			err = schemaErrorf(kptr, "multipleOf must be greater than 0")
+		} else if err == nil {
+			n.multipleOfRat = schemaRat(*n.multipleOf)
+		}
+	case "minLength":
+		n.minLength, err = schemaCount(v, kptr)
+	case "maxLength":
+		n.maxLength, err = schemaCount(v, kptr)
+	case "pattern":
+		if v.typ != LeptString {
+			return schemaErrorf(kptr, "pattern must be a string")
+		}
+		if n.pattern, err = regexp.Compile(v.s); err != nil {
+			err = schemaErrorf(kptr, "%v", err)
+		}
+	case "prefixItems":
+		n.prefixItems, err = c.compileArray(v, kptr)
+	case "items":
+		n.items, err = c.compile(v, kptr)
+	case "contains":
+		n.contains, err = c.compile(v, kptr)
+	case "minContains":
+		n.minContains, err = schemaCount(v, kptr)
+	case "maxContains":
+		n.maxContains, err = schemaCount(v, kptr)
+	case "minItems":
+		n.minItems, err = schemaCount(v, kptr)
+	case "maxItems":
+		n.maxItems, err = schemaCount(v, kptr)
+	case "uniqueItems":
+		if v.typ != LeptTrue && v.typ != LeptFalse {
+			return schemaErrorf(kptr, "uniqueItems must be a boolean")
+		}
+		n.uniqueItems = v.typ == LeptTrue
+	case "properties", "dependentSchemas":
+		if v.typ != LeptObject {
+			return schemaErrorf(kptr, "%s must be an object", key)
+		}
+		nodes := make(map[string]*schemaNode, len(v.o))
+		for _, m := range v.o {
+			if nodes[m.key], err = c.compile(m.value, kptr+"/"+escapePointer(m.key)); err != nil {
+				return err
+			}
+		}
+		if key == "properties" {
+			n.properties = nodes
+		} else {
+			n.dependentSchemas = nodes
+		}
+	case "patternProperties":
+		if v.typ != LeptObject {
+			return schemaErrorf(kptr, "patternProperties must be an object")
+		}
+		for _, m := range v.o {
+			p := schemaPattern{source: m.key}
+			mptr := kptr + "/" + escapePointer(m.key)
+			if p.re, err = regexp.Compile(m.key); err != nil {
+				return schemaErrorf(mptr, "%v", err)
+			}
+			if p.node, err = c.compile(m.value, mptr); err != nil {
+				return err
+			}
+			n.patternProperties = append(n.patternProperties, p)
+		}
+	case "additionalProperties":
+		n.additionalProperties, err = c.compile(v, kptr)
+	case "propertyNames":
+		n.propertyNames, err = c.compile(v, kptr)
+	case "required":
+		n.required, err = schemaStrings(v, kptr)
+	case "dependentRequired":
+		if v.typ != LeptObject {
+			return schemaErrorf(kptr, "dependentRequired must be an object")
+		}
+		for _, m := range v.o {
+			d := schemaDependency{key: m.key}
+			if d.required, err = schemaStrings(m.value, kptr+"/"+escapePointer(m.key)); err != nil {
+				return err
+			}
+			n.dependentRequired = append(n.dependentRequired, d)
+		}
+	case "minProperties":
+		n.minProperties, err = schemaCount(v, kptr)
+	case "maxProperties":
+		n.maxProperties, err = schemaCount(v, kptr)
+	case "allOf":
+		n.allOf, err = c.compileArray(v, kptr)
+	case "anyOf":
+		n.anyOf, err = c.compileArray(v, kptr)
+	case "oneOf":
+		n.oneOf, err = c.compileArray(v, kptr)
+	case "not":
+		n.not, err = c.compile(v, kptr)
+	case "if":
+		n.ifs, err = c.compile(v, kptr)
+	case "then":
+		n.then, err = c.compile(v, kptr)
+	case "else":
+		n.els, err = c.compile(v, kptr)
+	}
+	return err
+}
+
+// inPlace 返回 n 中作用于同一个值的子 schema，例如 {"$ref":"#"} 中的 $ref
+func (n *schemaNode) inPlace() []*schemaNode {
+	nodes := []*schemaNode{n.ref, n.not, n.ifs, n.then, n.els}
+	nodes = append(nodes, n.allOf...)
+	nodes = append(nodes, n.anyOf...)
+	nodes = append(nodes, n.oneOf...)
+	for _, d := range n.dependentSchemas {
+		nodes = append(nodes, d)
+	}
+	return nodes
+}
+
+// checkCycles 检查只经过 inPlace 的环，这样的 schema 检查时会无限递归
+func (c *schemaCompiler) checkCycles() error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[*schemaNode]int)
+	var visit func(n *schemaNode) bool
+	visit = func(n *schemaNode) bool {
+		switch state[n] {
+		case visiting:
+			return false
+		case done:
+			return true
+		}
+		state[n] = visiting
+		for _, sub := range n.inPlace() {
+			if sub != nil && !visit(sub) {
+				return false
+			}
+		}
+		state[n] = done
+		return true
+	}
+	ptrs := make([]string, 0, len(c.nodes))
+	for ptr := range c.nodes {
+		ptrs = append(ptrs, ptr)
+	}
+	sort.Strings(ptrs)
+	for _, ptr := range ptrs {
+		if !visit(c.nodes[ptr]) {
+			return schemaErrorf(ptr, "$ref cycle never reaches a child value")
+		}
+	}
+	return nil
+}
+
+// resolve 编译 $ref 指向的 schema，只支持 # 开头的 JSON Pointer
+func (c *schemaCompiler) resolve(ref, kptr string) (*schemaNode, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, schemaErrorf(kptr, "only local $ref is supported: %q", ref)
+	}
+	ptr, err := url.PathUnescape(ref[1:])
+	if err != nil || ptr != "" && ptr[0] != '/' {
+		return nil, schemaErrorf(kptr, "$ref must be a JSON Pointer: %q", ref)
+	}
+	target := c.root
+	for _, token := range strings.Split(ptr, "/")[1:] {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch target.typ {
+		case LeptObject:
+			target = LeptFindObjectValue(target, token)
+		case LeptArray:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(target.a) {
+				target = nil
+			} else {
+				target = target.a[i]
+			}
+		default:
+			target = nil
+		}
+		if target == nil {
+			return nil, schemaErrorf(kptr, "$ref target not found: %q", ref)
+		}
+	}
+	return c.compile(target, ptr)
+}
+
+func (c *schemaCompiler) compileArray(v *LeptValue, kptr string) ([]*schemaNode, error) {
+	if v.typ != LeptArray || len(v.a) == 0 {
+		return nil, schemaErrorf(kptr, "must be a non-empty array of schemas")
+	}
+	nodes := make([]*schemaNode, len(v.a))
+	for i, vi := range v.a {
+		n, err := c.compile(vi, kptr+"/"+strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = n
+	}
+	return nodes, nil
+}
+
+func schemaNumber(v *LeptValue, kptr string) (*float64, error) {
+	if v.typ != LeptNumber {
+		return nil, schemaErrorf(kptr, "must be a number")
+	}
+	n := v.n
+	return &n, nil
+}
+
+// schemaRat 返回 f 的最短十进制表示对应的有理数，0.07 是 7/100，而不是 float64 的二进制近似值
+func schemaRat(f float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	return r
+}
+
+func schemaCount(v *LeptValue, kptr string) (int, error) {
+	if v.typ != LeptNumber || v.n < 0 || v.n != math.Trunc(v.n) {
+		return 0, schemaErrorf(kptr, "must be a non-negative integer")
+	}
+	return int(v.n), nil
+}
+
+func schemaStrings(v *LeptValue, kptr string) ([]string, error) {
+	if v.typ != LeptArray {
+		return nil, schemaErrorf(kptr, "must be an array of strings")
+	}
+	s := make([]string, len(v.a))
+	for i, vi := range v.a {
+		if vi.typ != LeptString {
+			return nil, schemaErrorf(kptr, "must be an array of strings")
+		}
+		s[i] = vi.s
+	}
+	return s, nil
+}
+
+// Validate 检查 v 是否满足 schema，返回 basic 格式的结果
+func (s *Schema) Validate(v *LeptValue) *SchemaOutput {
+	w := &schemaValidator{}
+	w.validate(s.root, v, "", "")
+	return &SchemaOutput{Valid: len(w.errs) == 0, Errors: w.errs}
+}
+
+type schemaValidator struct {
+	errs []SchemaError
+}
+
+func (w *schemaValidator) fail(kw, inst, format string, args ...interface{}) {
+	w.errs = append(w.errs, SchemaError{KeywordLocation: kw, InstanceLocation: inst, Message: fmt.Sprintf(format, args...)})
+}
+
+// valid 判断 v 是否满足 n，不保留产生的错误
+func (w *schemaValidator) valid(n *schemaNode, v *LeptValue, kw, inst string) bool {
+	start := len(w.errs)
+	w.validate(n, v, kw, inst)
+	ok := len(w.errs) == start
+	w.errs = w.errs[:start]
+	return ok
+}
+
+// validate 检查 v 是否满足 n，kw 是 n 的求值路径，inst 是 v 在文档中的位置
+func (w *schemaValidator) validate(n *schemaNode, v *LeptValue, kw, inst string) {
+	if n.boolean != nil {
+		if !*n.boolean {
+			w.fail(kw, inst, "value is not allowed")
+		}
+		return
+	}
+	if n.ref != nil {
+		w.validate(n.ref, v, kw+"/$ref", inst)
+	}
+	if n.types != nil && !schemaTypeMatches(n.types, v) {
+		w.fail(kw+"/type", inst, "expected %s, but got %s", strings.Join(n.types, " or "), schemaTypeName(v))
+	}
+	if n.enum != nil {
+		found := false
+		for _, e := range n.enum {
+			if LeptIsEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			w.fail(kw+"/enum", inst, "value must be one of the enum values")
+		}
+	}
+	if n.cnst != nil && !LeptIsEqual(n.cnst, v) {
+		w.fail(kw+"/const", inst, "value must be equal to the const value")
+	}
+	switch v.typ {
+	case LeptNumber:
+		w.validateNumber(n, v.n, kw, inst)
+	case LeptString:
+		w.validateString(n, v.s, kw, inst)
+	case LeptArray:
+		w.validateArray(n, v, kw, inst)
+	case LeptObject:
+		w.validateObject(n, v, kw, inst)
+	}
+	w.validateApplicators(n, v, kw, inst)
+}
+
+func (w *schemaValidator) validateNumber(n *schemaNode, f float64, kw, inst string) {
+	if n.minimum != nil && f < *n.minimum {
+		w.fail(kw+"/minimum", inst, "must be >= %v", *n.minimum)
+	}
+	if n.maximum != nil && f > *n.maximum {
+		w.fail(kw+"/maximum", inst, "must be <= %v", *n.maximum)
+	}
+	if n.exclusiveMinimum != nil && f <= *n.exclusiveMinimum {
+		w.fail(kw+"/exclusiveMinimum", inst, "must be > %v", *n.exclusiveMinimum)
+	}
+	if n.exclusiveMaximum != nil && f >= *n.exclusiveMaximum {
+		w.fail(kw+"/exclusiveMaximum", inst, "must be < %v", *n.exclusiveMaximum)
+	}
+	if n.multipleOf != nil {
+		if math.IsInf(f, 0) || math.IsNaN(f) || !new(big.Rat).Quo(schemaRat(f), n.multipleOfRat).IsInt() {
+			w.fail(kw+"/multipleOf", inst, "must be a multiple of %v", *n.multipleOf)
+		}
+	}
+}
+
+func (w *schemaValidator) validateString(n *schemaNode, s, kw, inst string) {
+	if n.minLength >= 0 || n.maxLength >= 0 {
+		l := utf8.RuneCountInString(s)
+		if n.minLength >= 0 && l < n.minLength {
+			w.fail(kw+"/minLength", inst, "length must be >= %d", n.minLength)
+		}
+		if n.maxLength >= 0 && l > n.maxLength {
+			w.fail(kw+"/maxLength", inst, "length must be <= %d", n.maxLength)
+		}
+	}
+	if n.pattern != nil && !n.pattern.MatchString(s) {
+		w.fail(kw+"/pattern", inst, "must match pattern %q", n.pattern)
+	}
+}
+
+func (w *schemaValidator) validateArray(n *schemaNode, v *LeptValue, kw, inst string) {
+	if n.minItems >= 0 && len(v.a) < n.minItems {
+		w.fail(kw+"/minItems", inst, "must have at least %d items", n.minItems)
+	}
+	if n.maxItems >= 0 && len(v.a) > n.maxItems {
+		w.fail(kw+"/maxItems", inst, "must have at most %d items", n.maxItems)
+	}
+	if n.uniqueItems {
+	unique:
+		for i := 1; i < len(v.a); i++ {
+			for j := 0; j < i; j++ {
+				if LeptIsEqual(v.a[i], v.a[j]) {
+					w.fail(kw+"/uniqueItems", inst, "items at %d and %d are equal", j, i)
+					break unique
+				}
+			}
+		}
+	}
+	for i, vi := range v.a {
+		iinst := inst + "/" + strconv.Itoa(i)
+		if i < len(n.prefixItems) {
+			w.validate(n.prefixItems[i], vi, kw+"/prefixItems/"+strconv.Itoa(i), iinst)
+		} else if n.items != nil {
+			w.validate(n.items, vi, kw+"/items", iinst)
+		}
+	}
+	if n.contains != nil {
+		count := 0
+		for i, vi := range v.a {
+			if w.valid(n.contains, vi, kw+"/contains", inst+"/"+strconv.Itoa(i)) {
+				count++
+			}
+		}
+		min := 1
+		if n.minContains >= 0 {
+			min = n.minContains
+		}
+		if count < min {
+			w.fail(kw+"/contains", inst, "must contain at least %d matching items", min)
+		}
+		if n.maxContains >= 0 && count > n.maxContains {
+			w.fail(kw+"/maxContains", inst, "must contain at most %d matching items", n.maxContains)
+		}
+	}
+}
+
+func (w *schemaValidator) validateObject(n *schemaNode, v *LeptValue, kw, inst string) {
+	if n.minProperties >= 0 && len(v.o) < n.minProperties {
+		w.fail(kw+"/minProperties", inst, "must have at least %d properties", n.minProperties)
+	}
+	if n.maxProperties >= 0 && len(v.o) > n.maxProperties {
+		w.fail(kw+"/maxProperties", inst, "must have at most %d properties", n.maxProperties)
+	}
+	for _, key := range n.required {
+		if LeptFindObjectIndex(v, key) == LeptKeyNotExist {
+			w.fail(kw+"/required", inst, "missing required property %q", key)
+		}
+	}
+	for _, d := range n.dependentRequired {
+		if LeptFindObjectIndex(v, d.key) == LeptKeyNotExist {
+			continue
+		}
+		for _, key := range d.required {
+			if LeptFindObjectIndex(v, key) == LeptKeyNotExist {
+				w.fail(kw+"/dependentRequired/"+escapePointer(d.key), inst, "property %q is required when %q is present", key, d.key)
+			}
+		}
+	}
+	for _, m := range v.o {
+		minst := inst + "/" + escapePointer(m.key)
+		if n.propertyNames != nil {
+			// 属性名本身没有位置，使用 object 的位置
+			key := NewLeptValue()
+			LeptSetString(key, m.key)
+			w.validate(n.propertyNames, key, kw+"/propertyNames", inst)
+		}
+		matched := false
+		if p, ok := n.properties[m.key]; ok {
+			matched = true
+			w.validate(p, m.value, kw+"/properties/"+escapePointer(m.key), minst)
+		}
+		for _, p := range n.patternProperties {
+			if p.re.MatchString(m.key) {
+				matched = true
+				w.validate(p.node, m.value, kw+"/patternProperties/"+escapePointer(p.source), minst)
+			}
+		}
+		if !matched && n.additionalProperties != nil {
+			w.validate(n.additionalProperties, m.value, kw+"/additionalProperties", minst)
+		}
+		if d, ok := n.dependentSchemas[m.key]; ok {
+			w.validate(d, v, kw+"/dependentSchemas/"+escapePointer(m.key), inst)
+		}
+	}
+}
+
+func (w *schemaValidator) validateApplicators(n *schemaNode, v *LeptValue, kw, inst string) {
+	for i, sub := range n.allOf {
+		w.validate(sub, v, kw+"/allOf/"+strconv.Itoa(i), inst)
+	}
+	if n.anyOf != nil {
+		start := len(w.errs)
+		matched := false
+		for i, sub := range n.anyOf {
+			before := len(w.errs)
+			w.validate(sub, v, kw+"/anyOf/"+strconv.Itoa(i), inst)
+			if len(w.errs) == before {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			w.errs = w.errs[:start]
+		} else {
+			w.fail(kw+"/anyOf", inst, "must match at least one schema")
+		}
+	}
+	if n.oneOf != nil {
+		start := len(w.errs)
+		var matched []int
+		for i, sub := range n.oneOf {
+			before := len(w.errs)
+			w.validate(sub, v, kw+"/oneOf/"+strconv.Itoa(i), inst)
+			if len(w.errs) == before {
+				matched = append(matched, i)
+			}
+		}
+		switch len(matched) {
+		case 0:
+			w.fail(kw+"/oneOf", inst, "must match exactly one schema, but matches none")
+		case 1:
+			w.errs = w.errs[:start]
+		default:
+			w.errs = w.errs[:start]
+			w.fail(kw+"/oneOf", inst, "must match exactly one schema, but matches %d and %d", matched[0], matched[1])
+		}
+	}
+	if n.not != nil && w.valid(n.not, v, kw+"/not", inst) {
+		w.fail(kw+"/not", inst, "must not match the schema")
+	}
+	if n.ifs != nil {
+		if w.valid(n.ifs, v, kw+"/if", inst) {
+			if n.then != nil {
+				w.validate(n.then, v, kw+"/then", inst)
+			}
+		} else if n.els != nil {
+			w.validate(n.els, v, kw+"/else", inst)
+		}
+	}
+}
+
+func schemaTypeName(v *LeptValue) string {
+	switch v.typ {
+	case LeptNull:
+		return "null"
+	case LeptTrue, LeptFalse:
+		return "boolean"
+	case LeptNumber:
+		if v.n == math.Trunc(v.n) {
+			return "integer"
+		}
+		return "number"
+	case LeptString:
+		return "string"
+	case LeptArray:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// schemaTypeMatches 判断 v 是否是 types 中的一种，integer 是小数部分为 0 的 number
+func schemaTypeMatches(types []string, v *LeptValue) bool {
+	name := schemaTypeName(v)
+	for _, t := range types {
+		if t == name || t == "number" && name == "integer" {
+			return true
+		}
+	}
+	return false
+}
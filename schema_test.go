@@ -0,0 +1,151 @@
+package goleptjson
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSchemaKeywords(t *testing.T) {
+	tests := []struct {
+		schema string
+		valid  []string
+		errors []string
+	}{
+		{`true`, []string{`1`, `null`}, nil},
+		{`false`, nil, []string{`1`}},
+		{`{"type":"integer"}`, []string{`1`, `1.0`, `-3`}, []string{`1.5`, `"1"`, `null`}},
+		{`{"type":["string","null"]}`, []string{`"a"`, `null`}, []string{`1`, `[]`, `{}`, `true`}},
+		{`{"type":"number"}`, []string{`1`, `1.5`}, []string{`"1"`}},
+		{`{"enum":[1,"a",{"b":[1]}]}`, []string{`1.0`, `"a"`, `{"b":[1]}`}, []string{`2`, `{"b":[]}`}},
+		{`{"const":{"a":1,"b":2}}`, []string{`{"b":2,"a":1}`}, []string{`{"a":1}`}},
+		{`{"minimum":1,"exclusiveMaximum":3}`, []string{`1`, `2.9`, `"x"`}, []string{`0.9`, `3`}},
+		{`{"maximum":3,"exclusiveMinimum":1}`, []string{`3`, `1.1`}, []string{`1`, `3.1`}},
+		{`{"multipleOf":0.5}`, []string{`1.5`, `0`, `-2`}, []string{`1.2`}},
+		{`{"multipleOf":0.01}`, []string{`0.07`, `1.1`, `1e3`}, []string{`0.071`, `1e-3`}},
+		{`{"multipleOf":0.0001}`, []string{`0.0075`, `12345.6789`}, []string{`0.00001`}},
+		{`{"multipleOf":1e-300}`, []string{`1e308`}, []string{`1e-301`}},
+		{`{"minLength":2,"maxLength":3}`, []string{`"ab"`, `"éé"`, `"abc"`, `1`}, []string{`"a"`, `"abcd"`}},
+		{`{"pattern":"^[a-z]+$"}`, []string{`"abc"`}, []string{`"Abc"`}},
+		{`{"minItems":1,"maxItems":2,"uniqueItems":true}`, []string{`[1]`, `[1,"1"]`, `[{"a":1},{"a":2}]`}, []string{`[]`, `[1,2,3]`, `[{"a":1},{"a":1.0}]`}},
+		{`{"prefixItems":[{"type":"string"}],"items":{"type":"integer"}}`, []string{`[]`, `["a"]`, `["a",1,2]`}, []string{`[1]`, `["a","b"]`}},
+		{`{"items":false,"prefixItems":[true]}`, []string{`[1]`}, []string{`[1,2]`}},
+		{`{"contains":{"type":"string"}}`, []string{`[1,"a"]`}, []string{`[]`, `[1,2]`}},
+		{`{"contains":{"type":"string"},"minContains":2,"maxContains":3}`, []string{`["a","b"]`}, []string{`["a"]`, `["a","b","c","d"]`}},
+		{`{"contains":{"type":"string"},"minContains":0}`, []string{`[]`, `[1]`}, nil},
+		{`{"required":["a","b"],"minProperties":2,"maxProperties":3}`, []string{`{"a":1,"b":2}`, `[]`}, []string{`{"a":1}`, `{"a":1,"b":2,"c":3,"d":4}`}},
+		{`{"properties":{"a":{"type":"string"}},"patternProperties":{"^x-":{"type":"integer"}},"additionalProperties":false}`,
+			[]string{`{"a":"s","x-b":1}`, `{}`}, []string{`{"a":1}`, `{"x-b":"s"}`, `{"b":1}`}},
+		{`{"propertyNames":{"maxLength":2}}`, []string{`{"ab":1}`}, []string{`{"abc":1}`}},
+		{`{"dependentRequired":{"a":["b"]}}`, []string{`{"b":1}`, `{"a":1,"b":2}`}, []string{`{"a":1}`}},
+		{`{"dependentSchemas":{"a":{"required":["b"]}}}`, []string{`{}`, `{"a":1,"b":2}`}, []string{`{"a":1}`}},
+		{`{"allOf":[{"minimum":1},{"maximum":2}]}`, []string{`1.5`}, []string{`0`, `3`}},
+		{`{"anyOf":[{"type":"string"},{"minimum":2}]}`, []string{`"a"`, `3`}, []string{`1`}},
+		{`{"oneOf":[{"type":"integer"},{"minimum":2}]}`, []string{`1`, `2.5`}, []string{`3`, `1.5`}},
+		{`{"not":{"type":"string"}}`, []string{`1`}, []string{`"a"`}},
+		{`{"if":{"type":"string"},"then":{"minLength":2},"else":{"minimum":0}}`, []string{`"ab"`, `1`}, []string{`"a"`, `-1`}},
+		{`{"$defs":{"pos":{"minimum":0}},"$ref":"#/$defs/pos","maximum":10}`, []string{`5`}, []string{`-1`, `11`}},
+		{`{"$defs":{"a/b":{"type":"integer"}},"items":{"$ref":"#/$defs/a~1b"}}`, []string{`[1]`}, []string{`[1.5]`}},
+		// 递归的 schema
+		{`{"type":"object","properties":{"child":{"$ref":"#"}},"additionalProperties":false}`,
+			[]string{`{"child":{"child":{}}}`}, []string{`{"child":{"child":{"x":1}}}`}},
+	}
+	for _, tt := range tests {
+		s, err := LeptCompileSchema(mustParse(t, tt.schema))
+		if err != nil {
+			t.Errorf("LeptCompileSchema %s expect no err: %v", tt.schema, err)
+			continue
+		}
+		for _, input := range tt.valid {
+			if out := s.Validate(mustParse(t, input)); !out.Valid {
+				t.Errorf("schema %s expect %s valid, errors: %v", tt.schema, input, out.Errors)
+			}
+		}
+		for _, input := range tt.errors {
+			if out := s.Validate(mustParse(t, input)); out.Valid || len(out.Errors) == 0 {
+				t.Errorf("schema %s expect %s invalid", tt.schema, input)
+			}
+		}
+	}
+}
+
+func TestSchemaOutput(t *testing.T) {
+	schema := `{
+		"$defs": {"name": {"type": "string", "minLength": 1}},
+		"type": "object",
+		"required": ["id", "tags"],
+		"properties": {
+			"id": {"type": "integer", "minimum": 1},
+			"name": {"$ref": "#/$defs/name"},
+			"tags": {"type": "array", "items": {"enum": ["a", "b"]}},
+			"kind": {"anyOf": [{"const": "x"}, {"type": "integer"}]}
+		},
+		"additionalProperties": false
+	}`
+	s, err := LeptCompileSchema(mustParse(t, schema))
+	if err != nil {
+		t.Fatalf("LeptCompileSchema expect no err: %v", err)
+	}
+	out := s.Validate(mustParse(t, `{"id":0,"name":"","x/y":1,"kind":"y","tags":["a","c"]}`))
+	expectEQBool(t, false, out.Valid)
+	expect := `{"valid":false,"errors":[` +
+		`{"keywordLocation":"/properties/id/minimum","instanceLocation":"/id","error":"must be >= 1"},` +
+		`{"keywordLocation":"/properties/name/$ref/minLength","instanceLocation":"/name","error":"length must be >= 1"},` +
+		`{"keywordLocation":"/additionalProperties","instanceLocation":"/x~1y","error":"value is not allowed"},` +
+		`{"keywordLocation":"/properties/kind/anyOf/0/const","instanceLocation":"/kind","error":"value must be equal to the const value"},` +
+		`{"keywordLocation":"/properties/kind/anyOf/1/type","instanceLocation":"/kind","error":"expected integer, but got string"},` +
+		`{"keywordLocation":"/properties/kind/anyOf","instanceLocation":"/kind","error":"must match at least one schema"},` +
+		`{"keywordLocation":"/properties/tags/items/enum","instanceLocation":"/tags/1","error":"value must be one of the enum values"}]}`
+	expectEQString(t, expect, string(mustMarshal(t, out)))
+	expectEQString(t, "/id: must be >= 1 (/properties/id/minimum)", out.Errors[0].Error())
+
+	out = s.Validate(mustParse(t, `[]`))
+	expectEQString(t, `{"valid":false,"errors":[{"keywordLocation":"/type","instanceLocation":"","error":"expected object, but got array"}]}`,
+		string(mustMarshal(t, out)))
+	out = s.Validate(mustParse(t, `{"tags":[]}`))
+	expectEQString(t, `{"valid":false,"errors":[{"keywordLocation":"/required","instanceLocation":"","error":"missing required property \"id\""}]}`,
+		string(mustMarshal(t, out)))
+	out = s.Validate(mustParse(t, `{"id":1,"tags":[],"kind":3}`))
+	expectEQString(t, `{"valid":true}`, string(mustMarshal(t, out)))
+
+	out = mustSchema(t, `{"oneOf":[{"minimum":1},{"maximum":5}]}`).Validate(mustParse(t, `3`))
+	expectEQString(t, `{"valid":false,"errors":[{"keywordLocation":"/oneOf","instanceLocation":"","error":"must match exactly one schema, but matches 0 and 1"}]}`,
+		string(mustMarshal(t, out)))
+}
+
+func TestSchemaCompileError(t *testing.T) {
+	tests := []struct {
+		schema string
+		expect string
+	}{
+		{`1`, "invalid schema at #: schema must be an object or a boolean"},
+		{`{"type":"int"}`, `invalid schema at #/type: unknown type "int"`},
+		{`{"type":1}`, "invalid schema at #/type: type must be a string or an array of strings"},
+		{`{"minLength":-1}`, "invalid schema at #/minLength: must be a non-negative integer"},
+		{`{"maxItems":1.5}`, "invalid schema at #/maxItems: must be a non-negative integer"},
+		{`{"minimum":"1"}`, "invalid schema at #/minimum: must be a number"},
+		{`{"multipleOf":0}`, "invalid schema at #/multipleOf: multipleOf must be greater than 0"},
+		{`{"pattern":"("}`, "invalid schema at #/pattern: error parsing regexp: missing closing ): `(`"},
+		{`{"allOf":[]}`, "invalid schema at #/allOf: must be a non-empty array of schemas"},
+		{`{"required":[1]}`, "invalid schema at #/required: must be an array of strings"},
+		{`{"properties":{"a/b":{"items":1}}}`, "invalid schema at #/properties/a~1b/items: schema must be an object or a boolean"},
+		{`{"$ref":"#/$defs/missing"}`, `invalid schema at #/$ref: $ref target not found: "#/$defs/missing"`},
+		{`{"$ref":"other.json"}`, `invalid schema at #/$ref: only local $ref is supported: "other.json"`},
+		{`{"$ref":"#anchor"}`, `invalid schema at #/$ref: $ref must be a JSON Pointer: "#anchor"`},
+		{`{"$defs":{"unused":{"type":2}}}`, "invalid schema at #/$defs/unused/type: type must be a string or an array of strings"},
+		{`{"$ref":"#"}`, "invalid schema at #: $ref cycle never reaches a child value"},
+	}
+	for _, tt := range tests {
+		_, err := LeptCompileSchema(mustParse(t, tt.schema))
+		expectEQString(t, tt.expect, fmt.Sprint(err))
+	}
+	_, err := LeptCompileSchema(mustParse(t, `{"$defs":{"a":{"allOf":[{"$ref":"#/$defs/b"}]},"b":{"not":{"$ref":"#/$defs/a"}}}}`))
+	expectEQString(t, "invalid schema at #/$defs/a: $ref cycle never reaches a child value", fmt.Sprint(err))
+}
+
+func mustSchema(t *testing.T, schema string) *Schema {
+	s, err := LeptCompileSchema(mustParse(t, schema))
+	if err != nil {
+		t.Fatalf("LeptCompileSchema expect no err: %v", err)
+	}
+	return s
+}
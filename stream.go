@@ -0,0 +1,303 @@
+package goleptjson
+
+import (
+	"bytes"
+	"io"
+)
+
+// Encoder 将 json 值写入输出流，用法和 encoding/json.Encoder 一致
+type Encoder struct {
+	w         io.Writer
+	opts      *options
+	prefix    string
+	indent    string
+	indentBuf bytes.Buffer
+}
+
+// NewEncoder 返回写入 w 的 Encoder，和 encoding/json.Encoder 一样默认转义 HTML 字符，
+// 注意 Marshal 默认不转义，需要一致的输出时使用 SetEscapeHTML(false) 或者 Marshal 的 EscapeHTML
+func NewEncoder(w io.Writer) *Encoder {
+	enc := &Encoder{w: w, opts: newOptions(nil)}
+	enc.opts.escapeHTML = true
+	return enc
+}
+
+// SetIndent 设置之后 Encode 的每一层都会以 prefix 开头，并使用 indent 缩进
+func (enc *Encoder) SetIndent(prefix, indent string) {
+	enc.prefix = prefix
+	enc.indent = indent
+}
+
+// SetEscapeHTML 设置是否将字符串中的 < > & U+2028 U+2029 使用 \uXXXX 转义，和 EscapeHTML 一致
+func (enc *Encoder) SetEscapeHTML(on bool) {
+	enc.opts.escapeHTML = on
+}
+
+// SetNamingStrategy 设置没有在 tag 中指定名字的字段在 json 中的 key，和 FieldNaming 一致
+func (enc *Encoder) SetNamingStrategy(strategy NamingStrategy) {
+	FieldNaming(strategy)(enc.opts)
+}
+
+// SetSortKeys 设置 map 的 key 是否按照字符串排序，默认排序
+func (enc *Encoder) SetSortKeys(on bool) {
+	enc.opts.sortKeys = on
+}
+
+// Encode 将 v 编码之后写入输出流，最后添加一个换行符
+func (enc *Encoder) Encode(v interface{}) error {
+	e := &encodeState{opts: enc.opts}
+	if err := e.marshal(v); err != nil {
+		return err
+	}
+	b := e.Bytes()
+	if enc.prefix != "" || enc.indent != "" {
+		enc.indentBuf.Reset()
+		leptIndent(&enc.indentBuf, b, enc.prefix, enc.indent)
+		b = enc.indentBuf.Bytes()
+	}
+	b = append(b, '\n')
+	_, err := enc.w.Write(b)
+	return err
+}
+
+// leptIndent 将合法的 json src 格式化之后写入 dst，空的 array object 保持 [] {}
+func leptIndent(dst *bytes.Buffer, src []byte, prefix, indent string) {
+	depth := 0
+	inString := false
+	newline := func() {
+		dst.WriteByte('\n')
+		dst.WriteString(prefix)
+		for i := 0; i < depth; i++ {
+			dst.WriteString(indent)
+		}
+	}
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		if inString {
+			dst.WriteByte(c)
+			if c == '\\' {
+				i++
+				dst.WriteByte(src[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			// 丢弃原有的空白
+		case '"':
+			inString = true
+			dst.WriteByte(c)
+		case '{', '[':
+			dst.WriteByte(c)
+			j := leptSkipSpace(src, i+1)
+			if j < len(src) && (src[j] == '}' || src[j] == ']') {
+				dst.WriteByte(src[j])
+				i = j
+				continue
+			}
+			depth++
+			newline()
+		case '}', ']':
+			depth--
+			newline()
+			dst.WriteByte(c)
+		case ',':
+			dst.WriteByte(c)
+			newline()
+		case ':':
+			dst.WriteString(": ")
+		default:
+			dst.WriteByte(c)
+		}
+	}
+}
+
+func leptSkipSpace(src []byte, i int) int {
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t' || src[i] == '\n' || src[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// Decoder 从输入流中依次读取 json 值，用法和 encoding/json.Decoder 一致
+type Decoder struct {
+	r     io.Reader
+	opts  *options
+	buf   []byte
+	scanp int // buf[scanp:] 是还没有解析的部分
+	err   error
+}
+
+// NewDecoder 返回从 r 读取的 Decoder，Decoder 可能会读取超出当前值的数据
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, opts: newOptions(nil)}
+}
+
+// UseNumber 解析到 interface{} 的数字使用 Number 而不是 float64
+func (dec *Decoder) UseNumber() {
+	dec.opts.useNumber = true
+}
+
+// DisallowUnknownFields 解析到 struct 时，object 中有 struct 不存在的 key 返回错误
+func (dec *Decoder) DisallowUnknownFields() {
+	dec.opts.disallowUnknownFields = true
+}
+
+// SetNamingStrategy 解析到 struct 时，没有在 tag 中指定名字的字段使用 strategy 转换之后的 key 匹配
+func (dec *Decoder) SetNamingStrategy(strategy NamingStrategy) {
+	FieldNaming(strategy)(dec.opts)
+}
+
+// Decode 读取下一个 json 值并解析到 v 中
+func (dec *Decoder) Decode(v interface{}) error {
+	n, err := dec.readValue()
+	if err != nil {
+		return err
+	}
+	data := dec.buf[dec.scanp : dec.scanp+n]
+	dec.scanp += n
+	return unmarshal(data, v, dec.opts)
+}
+
+// Buffered 返回已经读取但是还没有解析的数据
+func (dec *Decoder) Buffered() io.Reader {
+	return bytes.NewReader(dec.buf[dec.scanp:])
+}
+
+// More 判断输入流中是否还有下一个值
+// Decoder 没有 Token 方法，Decode 每次读取一个完整的值，所以 More 不能用于 array object 的内部
+func (dec *Decoder) More() bool {
+	c, err := dec.peek()
+	return err == nil && c != ']' && c != '}'
+}
+
+// peek 跳过空白，返回下一个字符，但是不消耗它
+func (dec *Decoder) peek() (byte, error) {
+	var err error
+	for {
+		dec.scanp = leptSkipSpace(dec.buf, dec.scanp)
+		if dec.scanp < len(dec.buf) {
+			return dec.buf[dec.scanp], nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		err = dec.refill()
+	}
+}
+
+// readValue 读取数据直到 buf[scanp:] 中有一个完整的值，返回这个值的长度
+// 这里只根据括号和字符串找到值的边界，语法检查交给 Unmarshal
+func (dec *Decoder) readValue() (int, error) {
+	if _, err := dec.peek(); err != nil {
+		return 0, err
+	}
+	var s leptScanner
+	scanned := 0
+	for {
+		n, done := s.scan(dec.buf[dec.scanp+scanned:])
+		scanned += n
+		if done {
+			return scanned, nil
+		}
+		if err := dec.refill(); err != nil {
+			// Read 可能同时返回数据和错误，先扫描剩下的数据
+			if dec.scanp+scanned < len(dec.buf) {
+				continue
+			}
+			// 数字 true false null 在输入流结束的时候结束
+			if s.literal && err == io.EOF {
+				return scanned, nil
+			}
+			if err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+	}
+}
+
+// refill 读取更多的数据到 buf 中，并且丢弃已经解析的部分
+func (dec *Decoder) refill() error {
+	if dec.err != nil {
+		return dec.err
+	}
+	if dec.scanp > 0 {
+		n := copy(dec.buf, dec.buf[dec.scanp:])
+		dec.buf = dec.buf[:n]
+		dec.scanp = 0
+	}
+	const minRead = 512
+	if cap(dec.buf)-len(dec.buf) < minRead {
+		newBuf := make([]byte, len(dec.buf), 2*cap(dec.buf)+minRead)
+		copy(newBuf, dec.buf)
+		dec.buf = newBuf
+	}
+	n, err := dec.r.Read(dec.buf[len(dec.buf):cap(dec.buf)])
+	dec.buf = dec.buf[:len(dec.buf)+n]
+	if err != nil {
+		dec.err = err
+	}
+	return err
+}
+
+// leptScanner 增量地查找一个 json 值的结束位置，状态在多次 scan 之间保留
+type leptScanner struct {
+	started  bool
+	literal  bool // 当前的值是数字 true false null，遇到分隔符时结束
+	inString bool
+	escape   bool
+	depth    int
+}
+
+// scan 扫描 b，返回扫描过的字节数，done 表示值已经结束
+func (s *leptScanner) scan(b []byte) (int, bool) {
+	for i, c := range b {
+		if !s.started {
+			s.started = true
+			switch c {
+			case '{', '[':
+				s.depth = 1
+			case '"':
+				s.inString = true
+			default:
+				s.literal = true
+			}
+			continue
+		}
+		if s.literal {
+			switch c {
+			case ' ', '\t', '\n', '\r', ',', ']', '}', ':', '"', '[', '{':
+				return i, true
+			}
+			continue
+		}
+		if s.inString {
+			if s.escape {
+				s.escape = false
+			} else if c == '\\' {
+				s.escape = true
+			} else if c == '"' {
+				s.inString = false
+				if s.depth == 0 {
+					return i + 1, true
+				}
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			s.inString = true
+		case '{', '[':
+			s.depth++
+		case '}', ']':
+			s.depth--
+			if s.depth == 0 {
+				return i + 1, true
+			}
+		}
+	}
+	return len(b), false
+}
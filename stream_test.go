@@ -0,0 +1,160 @@
+package goleptjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+type streamItem struct {
+	Name  string            `json:"name"`
+	Tags  []string          `json:"tags"`
+	Attrs map[string]int    `json:"attrs"`
+	Empty []int             `json:"empty"`
+	Obj   map[string]string `json:"obj"`
+	HTML  string            `json:"html"`
+}
+
+func TestEncoder(t *testing.T) {
+	item := streamItem{
+		Name:  "a",
+		Tags:  []string{"x", "y"},
+		Attrs: map[string]int{"b": 2, "a": 1},
+		Empty: []int{},
+		Obj:   map[string]string{},
+		HTML:  "<a href=\"x\">&</a>",
+	}
+	tests := []struct {
+		prefix, indent string
+		escapeHTML     bool
+	}{
+		{"", "", true},
+		{"", "", false},
+		{"", "  ", true},
+		{">", "\t", false},
+	}
+	for _, tt := range tests {
+		var expect, actual bytes.Buffer
+		jenc := json.NewEncoder(&expect)
+		jenc.SetIndent(tt.prefix, tt.indent)
+		jenc.SetEscapeHTML(tt.escapeHTML)
+		enc := NewEncoder(&actual)
+		enc.SetIndent(tt.prefix, tt.indent)
+		enc.SetEscapeHTML(tt.escapeHTML)
+		for i := 0; i < 2; i++ {
+			if err := jenc.Encode(item); err != nil {
+				t.Errorf("json Encode expect no err: %v", err)
+			}
+			if err := enc.Encode(item); err != nil {
+				t.Errorf("Encode expect no err: %v", err)
+			}
+		}
+		expectEQString(t, expect.String(), actual.String())
+	}
+
+	// 不排序时 key 的顺序不确定，只检查内容
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetSortKeys(false)
+	m := map[string]int{"c": 3, "a": 1, "b": 2}
+	if err := enc.Encode(m); err != nil {
+		t.Errorf("Encode expect no err: %v", err)
+	}
+	actual := map[string]int{}
+	if err := Unmarshal(buf.Bytes(), &actual); err != nil {
+		t.Errorf("Unmarshal expect no err: %v", err)
+	}
+	expectEQString(t, fmt.Sprint(m), fmt.Sprint(actual))
+
+	buf.Reset()
+	err := NewEncoder(&buf).Encode(map[float64]int{1: 1})
+	expectEQString(t, "map key type is unsupported: float64", fmt.Sprint(err))
+	expectEQInt(t, 0, buf.Len())
+}
+
+func TestDecoder(t *testing.T) {
+	input := ` {"name":"a","tags":["x","]"]} [1,2]
+"s\"}" 12 true null {"name":"b"} 3.5`
+	readers := []io.Reader{
+		strings.NewReader(input),
+		iotest.OneByteReader(strings.NewReader(input)),
+		iotest.DataErrReader(strings.NewReader(input)),
+	}
+	for _, r := range readers {
+		dec := NewDecoder(r)
+		var item streamItem
+		if err := dec.Decode(&item); err != nil {
+			t.Fatalf("Decode expect no err: %v", err)
+		}
+		expectEQString(t, "]", item.Tags[1])
+		var values []interface{}
+		for dec.More() {
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				t.Fatalf("Decode expect no err: %v", err)
+			}
+			values = append(values, v)
+		}
+		expectEQString(t, `[[1 2] s"} 12 true <nil> map[name:b] 3.5]`, fmt.Sprint(values))
+		var v interface{}
+		if err := dec.Decode(&v); err != io.EOF {
+			t.Errorf("Decode expect io.EOF, actual: %v", err)
+		}
+	}
+
+	// Buffered 返回读取之后剩下的数据
+	dec := NewDecoder(strings.NewReader(`{"name":"a"} rest`))
+	var item streamItem
+	if err := dec.Decode(&item); err != nil {
+		t.Errorf("Decode expect no err: %v", err)
+	}
+	rest, _ := ioutil.ReadAll(dec.Buffered())
+	expectEQString(t, " rest", string(rest))
+
+	dec = NewDecoder(strings.NewReader(`{"n":12345678901234567890}`))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Errorf("Decode expect no err: %v", err)
+	}
+	expectEQString(t, "12345678901234567890", string(v.(map[string]interface{})["n"].(Number)))
+
+	dec = NewDecoder(strings.NewReader(`{"name":"a","unknown":1}`))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&item)
+	expectEQString(t, `unknown field "unknown"`, fmt.Sprint(err))
+	err = ToStruct(mustParse(t, `{"name":"a","unknown":1}`), &item, DisallowUnknownFields())
+	expectEQString(t, `unknown field "unknown"`, fmt.Sprint(err))
+
+	errs := []struct {
+		input  string
+		expect string
+	}{
+		{`{"name":"a"`, io.ErrUnexpectedEOF.Error()},
+		{`"abc`, io.ErrUnexpectedEOF.Error()},
+		{` `, io.EOF.Error()},
+		{`[1,}`, "Unmarshal parse error: LeptParseInvalidValue"},
+		{`tru`, "Unmarshal parse error: LeptParseInvalidValue"},
+	}
+	for _, tt := range errs {
+		var v interface{}
+		err := NewDecoder(strings.NewReader(tt.input)).Decode(&v)
+		expectEQString(t, tt.expect, fmt.Sprint(err))
+	}
+
+	// 读取值的中途发生的错误直接返回
+	dec = NewDecoder(iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader(`{"name":"a"}`))))
+	err = dec.Decode(&item)
+	expectEQString(t, iotest.ErrTimeout.Error(), fmt.Sprint(err))
+}
+
+func mustParse(t *testing.T, input string) *LeptValue {
+	v := NewLeptValue()
+	expectEQLeptEvent(t, LeptParseOK, LeptParse(v, input))
+	return v
+}
@@ -0,0 +1,400 @@
+package goleptjson
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidationError 是一个字段不满足 validate tag 中的一条规则
+type ValidationError struct {
+	Path    string // 字段在 json 中的位置，使用 JSON Pointer 表示，例如 /items/0/name
+	Rule    string // 不满足的规则，例如 min=1
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors 是一次检查中所有的 ValidationError，按照字段出现的顺序排列
+type ValidationErrors []*ValidationError
+
+func (es ValidationErrors) Error() string {
+	s := make([]string, len(es))
+	for i, e := range es {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// Validate Unmarshal ToStruct 成功之后使用 validate tag 检查结果，和 ValidateStruct 一致
+func Validate() Option {
+	return func(o *options) {
+		o.validate = true
+	}
+}
+
+// ValidateStruct 使用 validate tag 检查 structure 以及其中嵌套的 struct，
+// 不满足的规则全部放在 ValidationErrors 中返回，tag 本身有错误时返回普通的 error。
+// 支持的规则以逗号分隔，规则中的逗号写成 \,，tag 的值是带引号的 Go 字符串，所以在 struct tag 中写成 \\,，
+// 例如 `validate:"pattern=^a{1\\,3}$"`：
+//   - min=N max=N 对于数字比较数值，对于 string slice map array 比较长度，string 的长度是字符数
+//   - len=N string slice map array 的长度
+//   - pattern=re string 匹配正则表达式 re
+//   - oneof=a b c 值是空格分隔的其中一个
+//   - email string 是一个邮件地址
+//
+// nil 指针不做检查，有环时再次遇到的值跳过，路径中的 key 和 Marshal 相同，受 FieldNaming 影响
+func ValidateStruct(structure interface{}, opts ...Option) error {
+	return validateValue(reflect.ValueOf(structure), newOptions(opts))
+}
+
+func validateValue(rv reflect.Value, o *options) error {
+	w := &validator{o: o}
+	if err := w.value(rv, ""); err != nil {
+		return err
+	}
+	if len(w.errs) != 0 {
+		return w.errs
+	}
+	return nil
+}
+
+type validator struct {
+	o    *options
+	errs ValidationErrors
+	// ptrSeen 记录当前路径上的指针 map slice，再次遇到时说明有环，
+	// 环上的值已经在检查中，直接跳过，例如 p.Kids[0].Parent == p
+	ptrSeen map[cycleKey]struct{}
+}
+
+// enterCycleCheck 进入指针 map slice 之前调用，已经在当前路径上时返回 false，
+// 返回 true 时检查完之后需要调用 leaveCycleCheck
+func (w *validator) enterCycleCheck(rv reflect.Value) (cycleKey, bool) {
+	key := cycleKey{ptr: rv.Pointer(), typ: rv.Type()}
+	if rv.Kind() == reflect.Slice {
+		key.len = rv.Len()
+	}
+	if _, ok := w.ptrSeen[key]; ok {
+		return key, false
+	}
+	if w.ptrSeen == nil {
+		w.ptrSeen = make(map[cycleKey]struct{})
+	}
+	w.ptrSeen[key] = struct{}{}
+	return key, true
+}
+
+func (w *validator) leaveCycleCheck(key cycleKey) {
+	delete(w.ptrSeen, key)
+}
+
+// value 递归地检查 rv 中的 struct，path 是 rv 的 JSON Pointer
+func (w *validator) value(rv reflect.Value, path string) error {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		if rv.Kind() == reflect.Ptr {
+			key, ok := w.enterCycleCheck(rv)
+			if !ok {
+				return nil
+			}
+			defer w.leaveCycleCheck(key)
+		}
+		rv = rv.Elem()
+	}
+	if (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Map) && !rv.IsNil() && mayContainStruct(rv.Type().Elem()) {
+		key, ok := w.enterCycleCheck(rv)
+		if !ok {
+			return nil
+		}
+		defer w.leaveCycleCheck(key)
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		if rv.Type() == leptValueType {
+			return nil
+		}
+		rules, err := cachedValidateRules(rv.Type())
+		if err != nil {
+			return err
+		}
+		fields := w.o.typeFields(rv.Type())
+		for i := range fields.list {
+			f := &fields.list[i]
+			fv := rv.Field(f.index)
+			fpath := path + "/" + escapePointer(f.name)
+			w.field(fv, fpath, rules[f.index])
+			if err := w.value(fv, fpath); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if !mayContainStruct(rv.Type().Elem()) {
+			return nil
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := w.value(rv.Index(i), path+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if !mayContainStruct(rv.Type().Elem()) {
+			return nil
+		}
+		keys := rv.MapKeys()
+		sv := make([]reflectWithString, len(keys))
+		for i, k := range keys {
+			sv[i].v = k
+			if err := sv[i].resolve(); err != nil {
+				return err
+			}
+		}
+		sort.Slice(sv, func(i, j int) bool {
+			return sv[i].s < sv[j].s
+		})
+		for _, kv := range sv {
+			if err := w.value(rv.MapIndex(kv.v), path+"/"+escapePointer(kv.s)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// field 检查一个字段的全部规则，nil 指针跳过
+func (w *validator) field(fv reflect.Value, path string, rules []validateRule) {
+	if len(rules) == 0 {
+		return
+	}
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+	for i := range rules {
+		r := &rules[i]
+		if msg := r.check(fv); msg != "" {
+			w.errs = append(w.errs, &ValidationError{Path: path, Rule: r.text, Message: msg})
+		}
+	}
+}
+
+// mayContainStruct 判断 t 的值中是否可能有需要检查的 struct
+func mayContainStruct(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Interface, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// escapePointer 按照 RFC 6901 转义 JSON Pointer 中的 ~ 和 /
+func escapePointer(s string) string {
+	if !strings.ContainsAny(s, "~/") {
+		return s
+	}
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
+
+// validateRule 是 validate tag 中的一条规则
+type validateRule struct {
+	text  string // tag 中的原文，例如 min=1
+	name  string
+	n     float64 // min max len 的参数
+	re    *regexp.Regexp
+	oneof []string
+	size  bool // min max 比较长度而不是数值
+}
+
+// validateRules 是一个 struct 类型每个字段的规则，下标和 reflect.Type.Field 一致
+type validateRules struct {
+	rules [][]validateRule
+	err   error
+}
+
+var validateCache sync.Map // map[reflect.Type]*validateRules
+
+func cachedValidateRules(t reflect.Type) ([][]validateRule, error) {
+	if r, ok := validateCache.Load(t); ok {
+		vr := r.(*validateRules)
+		return vr.rules, vr.err
+	}
+	vr := &validateRules{rules: make([][]validateRule, t.NumField())}
+	for i := 0; i < t.NumField() && vr.err == nil; i++ {
+		sf := t.Field(i)
+		if tag, ok := sf.Tag.Lookup("validate"); ok {
+			vr.rules[i], vr.err = parseValidateTag(tag, sf.Type)
+			if vr.err != nil {
+				vr.err = fmt.Errorf("invalid validate tag on %v.%s: %v", t, sf.Name, vr.err)
+			}
+		} else if strings.Contains(string(sf.Tag), "validate:") {
+			// Lookup 遇到格式错误的 tag 会停止查找，例如缺少引号或者引号中的转义不合法
+			vr.err = fmt.Errorf("invalid validate tag on %v.%s: malformed struct tag", t, sf.Name)
+		}
+	}
+	r, _ := validateCache.LoadOrStore(t, vr)
+	vr = r.(*validateRules)
+	return vr.rules, vr.err
+}
+
+// parseValidateTag 解析 tag 中以逗号分隔的规则，并检查规则是否适用于字段的类型 ft
+func parseValidateTag(tag string, ft reflect.Type) ([]validateRule, error) {
+	for ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	isNumber := ft == numberType
+	isString := ft.Kind() == reflect.String && !isNumber
+	switch ft.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		isNumber = true
+	}
+	hasLen := isString || ft.Kind() == reflect.Slice || ft.Kind() == reflect.Map || ft.Kind() == reflect.Array
+	var rules []validateRule
+	for _, text := range splitValidateTag(tag) {
+		if text == "" {
+			continue
+		}
+		r := validateRule{text: text}
+		var arg string
+		if i := strings.IndexByte(text, '='); i >= 0 {
+			r.name, arg = text[:i], text[i+1:]
+		} else {
+			r.name = text
+		}
+		var err error
+		switch r.name {
+		case "min", "max", "len":
+			if !isNumber && !hasLen || r.name == "len" && !hasLen {
+				return nil, fmt.Errorf("%s cannot be used on %v", r.name, ft)
+			}
+			r.size = hasLen
+			r.n, err = strconv.ParseFloat(arg, 64)
+		case "pattern":
+			if !isString {
+				return nil, fmt.Errorf("%s cannot be used on %v", r.name, ft)
+			}
+			r.re, err = regexp.Compile(arg)
+		case "oneof":
+			if !isString && !isNumber {
+				return nil, fmt.Errorf("%s cannot be used on %v", r.name, ft)
+			}
+			r.oneof = strings.Fields(arg)
+			if isNumber {
+				for _, s := range r.oneof {
+					if _, err = strconv.ParseFloat(s, 64); err != nil {
+						break
+					}
+				}
+			}
+		case "email":
+			if !isString {
+				return nil, fmt.Errorf("%s cannot be used on %v", r.name, ft)
+			}
+		default:
+			return nil, fmt.Errorf("unknown rule %q", r.name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", text, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// splitValidateTag 以逗号分隔规则，\, 表示规则中的逗号
+func splitValidateTag(tag string) []string {
+	var rules []string
+	var cur strings.Builder
+	for i := 0; i < len(tag); i++ {
+		switch {
+		case tag[i] == '\\' && i+1 < len(tag) && tag[i+1] == ',':
+			cur.WriteByte(',')
+			i++
+		case tag[i] == ',':
+			rules = append(rules, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(tag[i])
+		}
+	}
+	return append(rules, cur.String())
+}
+
+// check 检查 v 是否满足规则，不满足时返回错误信息
+func (r *validateRule) check(v reflect.Value) string {
+	switch r.name {
+	case "min", "max", "len":
+		x := validateSize(v, r.size)
+		what := "value"
+		if r.size {
+			what = "length"
+		}
+		switch {
+		case r.name == "min" && x < r.n:
+			return fmt.Sprintf("%s must be at least %v", what, r.n)
+		case r.name == "max" && x > r.n:
+			return fmt.Sprintf("%s must be at most %v", what, r.n)
+		case r.name == "len" && x != r.n:
+			return fmt.Sprintf("length must be %v", r.n)
+		}
+	case "pattern":
+		if !r.re.MatchString(v.String()) {
+			return fmt.Sprintf("must match %s", r.re)
+		}
+	case "oneof":
+		for _, s := range r.oneof {
+			if v.Kind() == reflect.String && v.Type() != numberType {
+				if s == v.String() {
+					return ""
+				}
+			} else if f, _ := strconv.ParseFloat(s, 64); f == validateSize(v, false) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s]", strings.Join(r.oneof, " "))
+	case "email":
+		a, err := mail.ParseAddress(v.String())
+		if err != nil || a.Name != "" || a.Address != v.String() {
+			return "must be an email address"
+		}
+	}
+	return ""
+}
+
+// validateSize 返回 v 的长度，或者 v 的数值
+func validateSize(v reflect.Value, size bool) float64 {
+	if size {
+		if v.Kind() == reflect.String {
+			return float64(utf8.RuneCountInString(v.String()))
+		}
+		return float64(v.Len())
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		// Number
+		f, _ := strconv.ParseFloat(v.String(), 64)
+		return f
+	}
+	return 0
+}
@@ -0,0 +1,141 @@
+package goleptjson
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type validateItem struct {
+	Name  string   `json:"name" validate:"min=1,max=5,pattern=^[a-z]+$"`
+	Count *int     `json:"count" validate:"min=1,max=100"`
+	Tags  []string `json:"tags" validate:"max=2"`
+}
+
+type validateRequest struct {
+	Code    string                  `json:"code" validate:"len=3"`
+	Kind    string                  `json:"kind" validate:"oneof=a b c"`
+	Level   int                     `json:"level" validate:"oneof=1 2 3"`
+	Email   string                  `json:"email" validate:"email"`
+	Ratio   float64                 `json:"ratio" validate:"min=0,max=1"`
+	Amount  Number                  `json:"amount" validate:"min=0.5"`
+	Pattern string                  `json:"a/b~c" validate:"pattern=^x{1\\,2}$"`
+	Items   []validateItem          `json:"items" validate:"min=1"`
+	ByName  map[string]validateItem `json:"by_name"`
+}
+
+func TestValidate(t *testing.T) {
+	valid := `{"code":"abc","kind":"b","level":2,"email":"a@b.com","ratio":0.5,"amount":1,"a/b~c":"xx",` +
+		`"items":[{"name":"ab","count":1,"tags":["x"]}],"by_name":{"k":{"name":"c","count":100}}}`
+	var req validateRequest
+	if err := Unmarshal([]byte(valid), &req, Validate()); err != nil {
+		t.Errorf("Unmarshal expect no err: %v", err)
+	}
+
+	invalid := `{"code":"ab","kind":"d","level":4,"email":"Bob <b@c.com>","ratio":1.5,"amount":0.1,"a/b~c":"xxx",` +
+		`"items":[{"name":"ab","count":1},{"name":"Abcdef","count":0,"tags":["x","y","z"]}],` +
+		`"by_name":{"b":{"name":"","count":1},"a/1":{"name":"1","count":101}}}`
+	expect := []string{
+		"/code: length must be 3",
+		"/kind: must be one of [a b c]",
+		"/level: must be one of [1 2 3]",
+		"/email: must be an email address",
+		"/ratio: value must be at most 1",
+		"/amount: value must be at least 0.5",
+		"/a~1b~0c: must match ^x{1,2}$",
+		"/items/1/name: length must be at most 5",
+		"/items/1/name: must match ^[a-z]+$",
+		"/items/1/count: value must be at least 1",
+		"/items/1/tags: length must be at most 2",
+		"/by_name/a~11/name: must match ^[a-z]+$",
+		"/by_name/a~11/count: value must be at most 100",
+		"/by_name/b/name: length must be at least 1",
+		"/by_name/b/name: must match ^[a-z]+$",
+	}
+	for _, err := range []error{
+		Unmarshal([]byte(invalid), &validateRequest{}, Validate()),
+		ToStruct(mustParse(t, invalid), &validateRequest{}, Validate()),
+	} {
+		errs, ok := err.(ValidationErrors)
+		expectEQBool(t, true, ok)
+		expectEQInt(t, len(expect), len(errs))
+		for i := 0; i < len(expect) && i < len(errs); i++ {
+			expectEQString(t, expect[i], errs[i].Error())
+		}
+	}
+	// nil 指针不检查
+	errs := ValidateStruct(validateItem{Name: "é"}).(ValidationErrors)
+	expectEQInt(t, 1, len(errs))
+	expectEQString(t, "/name", errs[0].Path)
+	expectEQString(t, "pattern=^[a-z]+$", errs[0].Rule)
+	expectEQString(t, "must match ^[a-z]+$", errs[0].Message)
+
+	// 不使用 Validate 时不检查，类型错误优先于检查
+	if err := Unmarshal([]byte(invalid), &validateRequest{}); err != nil {
+		t.Errorf("Unmarshal expect no err: %v", err)
+	}
+	err := Unmarshal([]byte(`{"code":1}`), &validateRequest{}, Validate())
+	expectEQString(t, "v LeptValue is not a string: LeptNumber", fmt.Sprint(err))
+
+	// 路径使用 FieldNaming 转换之后的名字
+	var named struct {
+		UserName string `validate:"min=2"`
+	}
+	err = Unmarshal([]byte(`{"user_name":"a"}`), &named, FieldNaming(SnakeCase), Validate())
+	expectEQString(t, "/user_name: length must be at least 2", fmt.Sprint(err))
+
+	tagErrs := []struct {
+		x      interface{}
+		expect string
+	}{
+		{struct {
+			A int `validate:"len=1"`
+		}{}, "invalid validate tag on struct { A int \"validate:\\\"len=1\\\"\" }.A: len cannot be used on int"},
+		{struct {
+			A string `validate:"required"`
+		}{}, "invalid validate tag on struct { A string \"validate:\\\"required\\\"\" }.A: unknown rule \"required\""},
+		{struct {
+			A string `validate:"min=x"`
+		}{}, "invalid validate tag on struct { A string \"validate:\\\"min=x\\\"\" }.A: min=x: strconv.ParseFloat: parsing \"x\": invalid syntax"},
+		{struct {
+			A []int `validate:"pattern=a"`
+		}{}, "invalid validate tag on struct { A []int \"validate:\\\"pattern=a\\\"\" }.A: pattern cannot be used on []int"},
+	}
+	for _, tt := range tagErrs {
+		err := ValidateStruct(tt.x)
+		expectEQString(t, tt.expect, fmt.Sprint(err))
+	}
+
+	// 格式错误的 tag 无法 Lookup，同样返回错误；字面量中的 \, 会被 go vet 报告，所以使用 StructOf 构造
+	malformed := reflect.StructOf([]reflect.StructField{
+		{Name: "A", Type: reflect.TypeOf(""), Tag: `validate:"pattern=^a\,b$"`},
+	})
+	err = ValidateStruct(reflect.New(malformed).Elem().Interface())
+	expectEQString(t, `invalid validate tag on struct { A string "validate:\"pattern=^a\\,b$\"" }.A: malformed struct tag`, fmt.Sprint(err))
+}
+
+type validateNode struct {
+	Name   string          `json:"name" validate:"min=1"`
+	Parent *validateNode   `json:"-"`
+	Kids   []*validateNode `json:"kids"`
+}
+
+type validateTree map[string]validateTree
+
+func TestValidateCycle(t *testing.T) {
+	// 环上的值已经在检查中，再次遇到时跳过，每个错误只报告一次
+	p := &validateNode{Name: "p"}
+	p.Kids = []*validateNode{{Name: "", Parent: p}, {Name: "b", Parent: p}}
+	p.Kids[1].Kids = []*validateNode{p}
+	err := ValidateStruct(p)
+	expectEQString(t, "/kids/0/name: length must be at least 1", fmt.Sprint(err))
+
+	m := validateTree{}
+	m["self"] = m
+	expectEQString(t, "<nil>", fmt.Sprint(ValidateStruct(m)))
+
+	// 没有环时共享的值在每个路径上都检查
+	kid := &validateNode{}
+	err = ValidateStruct(&validateNode{Name: "p", Kids: []*validateNode{kid, kid}})
+	expectEQString(t, "/kids/0/name: length must be at least 1; /kids/1/name: length must be at least 1", fmt.Sprint(err))
+}